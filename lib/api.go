@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"slices"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -33,6 +34,11 @@ type StarsResponse struct {
 	MaxTime        int64   `json:"maxTime"`
 }
 
+var (
+	predictedStars     *[]*Star
+	predictedStarsLock sync.RWMutex
+)
+
 func GetStars() (*[]*Star, bool, error) {
 	response, err := getStars(ApiUrl)
 	if err != nil {
@@ -41,6 +47,7 @@ func GetStars() (*[]*Star, bool, error) {
 	now := time.Now().Unix()
 	forceUpdateListing := false
 	var stars []*Star
+	var predictions []*Star
 	for _, star := range *response {
 		depleteTime := int64(star.CalledAt) + int64(star.Tier*420)
 
@@ -48,7 +55,15 @@ func GetStars() (*[]*Star, bool, error) {
 			continue
 		}
 
-		if len(AllowedLocations) > 0 && !slices.Contains(AllowedLocations, strconv.Itoa(star.Location)) {
+		if star.CalledAt == 0 {
+			if isPrediction(star, now) && IsLocationAllowed(star.Location, nil) {
+				predictions = append(predictions, &Star{
+					Location: star.Location,
+					World:    star.World,
+					MinTime:  star.MinTime,
+					MaxTime:  star.MaxTime,
+				})
+			}
 			continue
 		}
 
@@ -56,6 +71,11 @@ func GetStars() (*[]*Star, bool, error) {
 		if mappedLocation == nil {
 			continue
 		}
+		CheckLocationMismatch(star.Location, star.CalledLocation, mappedLocation)
+
+		if !IsLocationAllowed(star.Location, mappedLocation) {
+			continue
+		}
 
 		if depleteTime < now {
 			log.Println("Mapped but depleted star found, force listing update...")
@@ -75,9 +95,33 @@ func GetStars() (*[]*Star, bool, error) {
 			DepleteTime:    int64(star.CalledAt) + int64(star.Tier*420),
 		})
 	}
+	setPredictedStars(&predictions)
 	return &stars, forceUpdateListing, nil
 }
 
+// isPrediction tells whether the star has not been called yet and can still
+// land within its window.
+func isPrediction(star *StarsResponse, now int64) bool {
+	return star.CalledAt == 0 && star.MaxTime > now
+}
+
+// setPredictedStars stores stars that have not landed yet, with MinTime and
+// MaxTime as the landing window.
+func setPredictedStars(stars *[]*Star) {
+	predictedStarsLock.Lock()
+	defer predictedStarsLock.Unlock()
+	predictedStars = stars
+}
+
+func GetPredictedStars() *[]*Star {
+	predictedStarsLock.RLock()
+	defer predictedStarsLock.RUnlock()
+	if predictedStars == nil {
+		return &[]*Star{}
+	}
+	return predictedStars
+}
+
 func getStars(url string) (*[]*StarsResponse, error) {
 	now := strconv.FormatInt(time.Now().UnixMilli(), 10)
 	client := http.Client{
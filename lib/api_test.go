@@ -0,0 +1,56 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIsPrediction(t *testing.T) {
+	const now = int64(1_000_000)
+	for _, test := range []struct {
+		name       string
+		star       StarsResponse
+		prediction bool
+	}{
+		{"upcoming window", StarsResponse{MinTime: now - 60, MaxTime: now + 60}, true},
+		{"window passed", StarsResponse{MinTime: now - 120, MaxTime: now - 60}, false},
+		{"window ends now", StarsResponse{MaxTime: now}, false},
+		{"called within the window", StarsResponse{CalledAt: float64(now - 30), MaxTime: now + 60}, false},
+	} {
+		if prediction := isPrediction(&test.star, now); prediction != test.prediction {
+			t.Errorf("%s: prediction %v, expected %v", test.name, prediction, test.prediction)
+		}
+	}
+}
+
+func TestGetStarsNeverPredictsCalledStars(t *testing.T) {
+	now := time.Now().Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_ = json.NewEncoder(writer).Encode([]StarsResponse{
+			{World: 301, Location: 1, CalledLocation: "Aldarin", CalledAt: float64(now - 60), Tier: 8, MinTime: now - 600, MaxTime: now + 600},
+			{World: 302, Location: 2, MinTime: now - 600, MaxTime: now + 600},
+			{World: 303, Location: 3, MinTime: now - 1200, MaxTime: now - 600},
+		})
+	}))
+	defer server.Close()
+	apiUrl := ApiUrl
+	ApiUrl = server.URL
+	t.Cleanup(func() {
+		ApiUrl = apiUrl
+		setPredictedStars(nil)
+	})
+
+	if _, _, err := GetStars(); err != nil {
+		t.Fatalf("GetStars failed: %v", err)
+	}
+	predictions := *GetPredictedStars()
+	if len(predictions) != 1 || predictions[0].World != 302 {
+		t.Fatalf("unexpected predictions %+v", predictions)
+	}
+	if predictions[0].MinTime != now-600 || predictions[0].MaxTime != now+600 || predictions[0].CalledAt != 0 {
+		t.Errorf("unexpected landing window %+v", predictions[0])
+	}
+}
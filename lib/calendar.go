@@ -0,0 +1,191 @@
+package lib
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CalendarNotifier serves active stars from CalledAt to DepleteTime and
+// predicted stars over their landing window as an iCalendar feed. Event uids
+// do not depend on the tier or time estimates, so calendar apps update the
+// events in place as those change.
+type CalendarNotifier struct {
+	lock  sync.RWMutex
+	stars *[]*Star
+
+	windowLock sync.Mutex
+	windows    map[string]predictionWindow
+}
+
+// predictionWindow is the landing window last served for a predicted star,
+// and when it was first served.
+type predictionWindow struct {
+	start, end int64
+	servedAt   int64
+}
+
+// calendarEpoch is the start of the minutes counted by prediction sequences,
+// 2025-01-01T00:00:00Z.
+const calendarEpoch = 1735689600
+
+func NewCalendarNotifier() *CalendarNotifier {
+	return &CalendarNotifier{
+		windows: make(map[string]predictionWindow),
+	}
+}
+
+func (notifier *CalendarNotifier) Name() string {
+	return "calendar"
+}
+
+func (notifier *CalendarNotifier) PostListing(stars *[]*Star) error {
+	return notifier.UpdateListing(stars)
+}
+
+func (notifier *CalendarNotifier) UpdateListing(stars *[]*Star) error {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	notifier.stars = stars
+	return nil
+}
+
+func (notifier *CalendarNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	return nil
+}
+
+func (notifier *CalendarNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+func (notifier *CalendarNotifier) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	notifier.lock.RLock()
+	stars := notifier.stars
+	notifier.lock.RUnlock()
+	if stars == nil {
+		stars = &[]*Star{}
+	}
+
+	writer.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	writer.Header().Set("Content-Disposition", "inline; filename=\"stars.ics\"")
+	_, _ = writer.Write([]byte(createCalendar(stars, GetPredictedStars(), notifier.predictionSequence, time.Now().Unix())))
+}
+
+// predictionSequence returns the SEQUENCE of a predicted event, which is the
+// minute its landing window was first served with the current times. The
+// sequence grows whenever the window changes, also across restarts.
+func (notifier *CalendarNotifier) predictionSequence(uid string, start, end, now int64) int {
+	notifier.windowLock.Lock()
+	defer notifier.windowLock.Unlock()
+	window, ok := notifier.windows[uid]
+	if !ok || window.start != start || window.end != end {
+		window = predictionWindow{start: start, end: end, servedAt: now}
+		notifier.windows[uid] = window
+	}
+	return int((window.servedAt - calendarEpoch) / 60)
+}
+
+func createCalendar(stars, predictions *[]*Star, predictionSequence func(uid string, start, end, now int64) int, now int64) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//star-notifier//Shooting stars//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Shooting stars",
+		"REFRESH-INTERVAL;VALUE=DURATION:PT5M",
+		"X-PUBLISHED-TTL:PT5M",
+	}
+
+	for _, star := range *stars {
+		lines = append(lines, createCalendarEvent(
+			fmt.Sprintf("star-%d-%d-%d@star-notifier", star.World, star.Location, star.CalledAt),
+			// tiers only go down while a star is mined, so the sequence grows
+			// with every update
+			10-star.Tier,
+			formatStarTitle(star),
+			formatPlainStarLine(star, now),
+			star.CalledLocation,
+			MapUrl(star.MappedLocation),
+			star.CalledAt,
+			star.DepleteTime,
+			now,
+		)...)
+	}
+	for _, star := range *predictions {
+		location := GetRegionName(star.Location, nil)
+		if len(location) == 0 {
+			location = fmt.Sprintf("location %d", star.Location)
+		}
+		uid := fmt.Sprintf("predicted-%d-%d@star-notifier", star.World, star.Location)
+		lines = append(lines, createCalendarEvent(
+			uid,
+			predictionSequence(uid, star.MinTime, star.MaxTime, now),
+			fmt.Sprintf("Predicted star w%d %s", star.World, location),
+			fmt.Sprintf("A star is predicted to land on world %d (%s) within this window", star.World, location),
+			location,
+			WikiUrl,
+			star.MinTime,
+			star.MaxTime,
+			now,
+		)...)
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+	var builder strings.Builder
+	for _, line := range lines {
+		builder.WriteString(foldCalendarLine(line))
+		builder.WriteString("\r\n")
+	}
+	return builder.String()
+}
+
+func createCalendarEvent(uid string, sequence int, summary, description, location, url string, start, end, now int64) []string {
+	return []string{
+		"BEGIN:VEVENT",
+		"UID:" + uid,
+		fmt.Sprintf("SEQUENCE:%d", sequence),
+		"DTSTAMP:" + formatCalendarTime(now),
+		"LAST-MODIFIED:" + formatCalendarTime(now),
+		"DTSTART:" + formatCalendarTime(start),
+		"DTEND:" + formatCalendarTime(end),
+		"SUMMARY:" + escapeCalendarText(summary),
+		"DESCRIPTION:" + escapeCalendarText(description),
+		"LOCATION:" + escapeCalendarText(location),
+		"URL:" + url,
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+	}
+}
+
+func formatCalendarTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format("20060102T150405Z")
+}
+
+func escapeCalendarText(text string) string {
+	return strings.NewReplacer(
+		"\\", "\\\\",
+		";", "\\;",
+		",", "\\,",
+		"\n", "\\n",
+	).Replace(text)
+}
+
+// foldCalendarLine splits lines longer than 75 octets, continuing them on
+// lines starting with a space. Multi-byte characters are not split.
+func foldCalendarLine(line string) string {
+	var builder strings.Builder
+	length := 0
+	for _, char := range line {
+		size := len(string(char))
+		if length+size > 75 {
+			builder.WriteString("\r\n ")
+			length = 1
+		}
+		builder.WriteRune(char)
+		length += size
+	}
+	return builder.String()
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestEscapeCalendarText(t *testing.T) {
+	for _, test := range []struct {
+		text, escaped string
+	}{
+		{"Aldarin", "Aldarin"},
+		{"Mine, north; east", "Mine\\, north\\; east"},
+		{"C:\\stars", "C:\\\\stars"},
+		{"first\nsecond", "first\\nsecond"},
+	} {
+		if escaped := escapeCalendarText(test.text); escaped != test.escaped {
+			t.Errorf("escapeCalendarText(%q) = %q, expected %q", test.text, escaped, test.escaped)
+		}
+	}
+}
+
+func TestFoldCalendarLine(t *testing.T) {
+	for _, line := range []string{
+		"SUMMARY:short",
+		"DESCRIPTION:" + strings.Repeat("a", 63),
+		"DESCRIPTION:" + strings.Repeat("a", 64),
+		"DESCRIPTION:" + strings.Repeat("a", 200),
+		"LOCATION:" + strings.Repeat("Läkeside ✦ ", 20),
+	} {
+		folded := foldCalendarLine(line)
+		for index, part := range strings.Split(folded, "\r\n") {
+			if len(part) > 75 {
+				t.Errorf("folded line %d has %d octets: %q", index, len(part), part)
+			}
+			if index > 0 && !strings.HasPrefix(part, " ") {
+				t.Errorf("continuation line %d does not start with a space: %q", index, part)
+			}
+			if !utf8.ValidString(part) {
+				t.Errorf("folded line %d splits a character: %q", index, part)
+			}
+		}
+		if unfolded := strings.ReplaceAll(folded, "\r\n ", ""); unfolded != line {
+			t.Errorf("unfolded line %q differs from %q", unfolded, line)
+		}
+		if len(line) <= 75 && folded != line {
+			t.Errorf("line of %d octets was folded: %q", len(line), folded)
+		}
+	}
+}
+
+func TestCreateCalendar(t *testing.T) {
+	const now = int64(1767225600)
+	stars := &[]*Star{{CalledLocation: "Mine, north", Location: 7, Tier: 6, World: 330, CalledAt: now - 60, DepleteTime: now + 600}}
+	predictions := &[]*Star{{Location: 12, World: 420, MinTime: now + 1200, MaxTime: now + 3600}}
+
+	calendar := createCalendar(stars, predictions, func(uid string, start, end, now int64) int {
+		return 3
+	}, now)
+	if !strings.HasPrefix(calendar, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(calendar, "END:VCALENDAR\r\n") {
+		t.Fatalf("unexpected calendar %q", calendar)
+	}
+	for _, expected := range []string{
+		"UID:star-330-7-1767225540@star-notifier\r\nSEQUENCE:4\r\n",
+		"DTSTART:20251231T235900Z\r\nDTEND:20260101T001000Z\r\n",
+		"SUMMARY:T6 star w330 Mine\\, north\r\n",
+		"LOCATION:Mine\\, north\r\n",
+		"UID:predicted-420-12@star-notifier\r\nSEQUENCE:3\r\n",
+		"DTSTART:20260101T002000Z\r\nDTEND:20260101T010000Z\r\n",
+	} {
+		if !strings.Contains(calendar, expected) {
+			t.Errorf("calendar does not contain %q", expected)
+		}
+	}
+	if strings.Count(calendar, "BEGIN:VEVENT") != 2 || strings.Count(calendar, "END:VEVENT") != 2 {
+		t.Errorf("expected two events in %q", calendar)
+	}
+}
+
+func TestPredictionSequence(t *testing.T) {
+	notifier := NewCalendarNotifier()
+	const now = int64(calendarEpoch + 600)
+
+	first := notifier.predictionSequence("uid", 100, 200, now)
+	if first != 10 {
+		t.Errorf("expected the sequence to count minutes since the epoch, got %d", first)
+	}
+	if sequence := notifier.predictionSequence("uid", 100, 200, now+300); sequence != first {
+		t.Errorf("sequence of an unchanged window changed from %d to %d", first, sequence)
+	}
+	if sequence := notifier.predictionSequence("uid", 100, 260, now+300); sequence <= first {
+		t.Errorf("sequence of a changed window did not grow: %d", sequence)
+	}
+}
@@ -7,43 +7,159 @@ import (
 	"log"
 	"os"
 	"slices"
+	"sync"
 	"time"
 )
 
 type NewStarMessage struct {
 	WebhookUrl      string `json:"webhookUrl"`
 	MessageId       string `json:"messageId"`
+	ThreadId        string `json:"threadId,omitempty"`
 	PostedTimestamp int64  `json:"postedTimestamp"`
 }
 
+// StarRecord is a snapshot of a star stored for later delivery.
+type StarRecord struct {
+	Location       int    `json:"location"`
+	CalledLocation string `json:"calledLocation"`
+	Tier           int    `json:"tier"`
+	World          int    `json:"world"`
+	CalledAt       int64  `json:"calledAt"`
+	MinTime        int64  `json:"minTime"`
+	MaxTime        int64  `json:"maxTime"`
+	DepleteTime    int64  `json:"depleteTime"`
+}
+
+type DigestEntry struct {
+	WebhookUrl     string     `json:"webhookUrl"`
+	Star           StarRecord `json:"star"`
+	AddedTimestamp int64      `json:"addedTimestamp"`
+}
+
+type RecentStar struct {
+	Star              StarRecord `json:"star"`
+	DetectedTimestamp int64      `json:"detectedTimestamp"`
+}
+
+// OutboxEntry is a pending Discord operation, kept until it is delivered or
+// expires.
+type OutboxEntry struct {
+	Id                   string       `json:"id"`
+	WebhookUrl           string       `json:"webhookUrl"`
+	Kind                 string       `json:"kind"`
+	Stars                []StarRecord `json:"stars,omitempty"`
+	RoleIds              []string     `json:"roleIds,omitempty"`
+	MessageId            string       `json:"messageId,omitempty"`
+	ThreadId             string       `json:"threadId,omitempty"`
+	Retained             bool         `json:"retained,omitempty"`
+	CreatedTimestamp     int64        `json:"createdTimestamp"`
+	Attempts             int          `json:"attempts"`
+	NextAttemptTimestamp int64        `json:"nextAttemptTimestamp"`
+}
+
+// Database is safe for concurrent use, deliveries to different webhooks
+// update it in parallel.
 type Database struct {
+	lock     sync.Mutex
 	filePath string
 	content  *DatabaseContent
 }
 
 type DatabaseContent struct {
-	ListingMessages map[string]string `json:"listingMessages"`
-	NewStarMessages []NewStarMessage  `json:"newStarMessages"`
+	ListingMessages map[string]MessageIds `json:"listingMessages"`
+	NewStarMessages []NewStarMessage      `json:"newStarMessages"`
+	LastMentions    map[string]int64      `json:"lastMentions"`
+	DigestEntries   []DigestEntry         `json:"digestEntries"`
+	LastDigests     map[string]int64      `json:"lastDigests"`
+	RecentStars     []RecentStar          `json:"recentStars"`
+	Outbox          []OutboxEntry         `json:"outbox"`
+	ListingThreads  map[string]string     `json:"listingThreads"`
+	RetainedTopics  []string              `json:"retainedTopics"`
+}
+
+// MessageIds is an ordered list of message ids, read from either a list or
+// the single id stored by earlier versions.
+type MessageIds []string
+
+func (ids *MessageIds) UnmarshalJSON(data []byte) error {
+	var messageId string
+	if err := json.Unmarshal(data, &messageId); err == nil {
+		*ids = nil
+		if len(messageId) > 0 {
+			*ids = MessageIds{messageId}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(ids))
 }
 
+// GetListingMessage returns the first listing message, for destinations with
+// a single listing message.
 func (db *Database) GetListingMessage(webhookUrl string) *string {
-	messageId := db.content.ListingMessages[webhookUrl]
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var messageId string
+	if messageIds := db.content.ListingMessages[webhookUrl]; len(messageIds) > 0 {
+		messageId = messageIds[0]
+	}
 	return &messageId
 }
 
 func (db *Database) SetListingMessage(webhookUrl, messageId string) {
-	db.content.ListingMessages[webhookUrl] = messageId
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.ListingMessages[webhookUrl] = MessageIds{messageId}
+}
+
+// GetListingMessages returns the ids of the listing pages in order.
+func (db *Database) GetListingMessages(webhookUrl string) []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return slices.Clone(db.content.ListingMessages[webhookUrl])
+}
+
+func (db *Database) SetListingMessages(webhookUrl string, messageIds []string) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.ListingMessages[webhookUrl] = slices.Clone(messageIds)
 }
 
 func (db *Database) AddNewStarMessage(webhookUrl, messageId string, timestamp int64) {
+	db.AddThreadNewStarMessage(webhookUrl, "", messageId, timestamp)
+}
+
+// AddThreadNewStarMessage records a new star message posted in a thread, which
+// is needed to delete it later.
+func (db *Database) AddThreadNewStarMessage(webhookUrl, threadId, messageId string, timestamp int64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	db.content.NewStarMessages = append(db.content.NewStarMessages, NewStarMessage{
 		WebhookUrl:      webhookUrl,
 		MessageId:       messageId,
+		ThreadId:        threadId,
 		PostedTimestamp: timestamp,
 	})
 }
 
+// GetListingThread returns the thread holding the listing of a webhook, which
+// is the forum post of forum webhooks. The thread is unknown for listings
+// posted by earlier versions.
+func (db *Database) GetListingThread(webhookUrl string) (string, bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	threadId, ok := db.content.ListingThreads[webhookUrl]
+	return threadId, ok
+}
+
+func (db *Database) SetListingThread(webhookUrl, threadId string) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.ListingThreads[webhookUrl] = threadId
+}
+
 func (db *Database) RemoveNewStarMessages(messages *[]*NewStarMessage) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	db.content.NewStarMessages = slices.DeleteFunc(
 		db.content.NewStarMessages,
 		func(storedMessage NewStarMessage) bool {
@@ -54,10 +170,169 @@ func (db *Database) RemoveNewStarMessages(messages *[]*NewStarMessage) {
 	)
 }
 
-func (db *Database) GetOldNewStarMessages(maxAge int) *[]*NewStarMessage {
+func (db *Database) GetLastMention(webhookUrl, roleId string) int64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.content.LastMentions[mentionKey(webhookUrl, roleId)]
+}
+
+func (db *Database) SetLastMention(webhookUrl, roleId string, timestamp int64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.LastMentions[mentionKey(webhookUrl, roleId)] = timestamp
+}
+
+func mentionKey(webhookUrl, roleId string) string {
+	return webhookUrl + "|" + roleId
+}
+
+// AddDigestStar buffers a star for the next digest of a webhook, replacing
+// an earlier snapshot of the same star.
+func (db *Database) AddDigestStar(webhookUrl string, star StarRecord, timestamp int64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.DigestEntries = slices.DeleteFunc(db.content.DigestEntries, func(entry DigestEntry) bool {
+		return entry.WebhookUrl == webhookUrl && entry.Star.World == star.World &&
+			entry.Star.Location == star.Location && entry.Star.CalledLocation == star.CalledLocation
+	})
+	db.content.DigestEntries = append(db.content.DigestEntries, DigestEntry{
+		WebhookUrl:     webhookUrl,
+		Star:           star,
+		AddedTimestamp: timestamp,
+	})
+}
+
+func (db *Database) GetDigestStars(webhookUrl string) []StarRecord {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var stars []StarRecord
+	for _, entry := range db.content.DigestEntries {
+		if entry.WebhookUrl == webhookUrl {
+			stars = append(stars, entry.Star)
+		}
+	}
+	return stars
+}
+
+func (db *Database) ClearDigest(webhookUrl string, timestamp int64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.DigestEntries = slices.DeleteFunc(db.content.DigestEntries, func(entry DigestEntry) bool {
+		return entry.WebhookUrl == webhookUrl
+	})
+	db.content.LastDigests[webhookUrl] = timestamp
+}
+
+func (db *Database) GetLastDigest(webhookUrl string) int64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return db.content.LastDigests[webhookUrl]
+}
+
+// AddRecentStar records a detected star, keeping at most limit of the most
+// recent ones.
+func (db *Database) AddRecentStar(star StarRecord, timestamp int64, limit int) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.RecentStars = append(db.content.RecentStars, RecentStar{
+		Star:              star,
+		DetectedTimestamp: timestamp,
+	})
+	if len(db.content.RecentStars) > limit {
+		db.content.RecentStars = db.content.RecentStars[len(db.content.RecentStars)-limit:]
+	}
+}
+
+func (db *Database) GetRecentStars() []RecentStar {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return slices.Clone(db.content.RecentStars)
+}
+
+// GetRetainedTopics returns the MQTT topics holding retained star state.
+func (db *Database) GetRetainedTopics() []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	return slices.Clone(db.content.RetainedTopics)
+}
+
+func (db *Database) SetRetainedTopics(topics []string) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.RetainedTopics = slices.Clone(topics)
+}
+
+// SetOutboxEntry replaces the entry with the same id in place, or appends
+// the entry to the end of the outbox.
+func (db *Database) SetOutboxEntry(entry OutboxEntry) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	index := slices.IndexFunc(db.content.Outbox, func(stored OutboxEntry) bool {
+		return stored.Id == entry.Id
+	})
+	if index >= 0 {
+		db.content.Outbox[index] = entry
+	} else {
+		db.content.Outbox = append(db.content.Outbox, entry)
+	}
+}
+
+// GetOutboxEntries returns the entries of a webhook in the order they were
+// added.
+func (db *Database) GetOutboxEntries(webhookUrl string) []OutboxEntry {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var entries []OutboxEntry
+	for _, entry := range db.content.Outbox {
+		if entry.WebhookUrl == webhookUrl {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// GetOutboxWebhooks returns the webhooks that have pending outbox entries.
+func (db *Database) GetOutboxWebhooks() []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var webhookUrls []string
+	for _, entry := range db.content.Outbox {
+		if !slices.Contains(webhookUrls, entry.WebhookUrl) {
+			webhookUrls = append(webhookUrls, entry.WebhookUrl)
+		}
+	}
+	return webhookUrls
+}
+
+func (db *Database) RemoveOutboxEntries(remove func(entry OutboxEntry) bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.content.Outbox = slices.DeleteFunc(db.content.Outbox, remove)
+}
+
+// GetNewStarMessageWebhooks returns the webhooks that have stored new star
+// messages.
+func (db *Database) GetNewStarMessageWebhooks() []string {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	var webhookUrls []string
+	for _, message := range db.content.NewStarMessages {
+		if !slices.Contains(webhookUrls, message.WebhookUrl) {
+			webhookUrls = append(webhookUrls, message.WebhookUrl)
+		}
+	}
+	return webhookUrls
+}
+
+func (db *Database) GetOldNewStarMessages(webhookUrl string, maxAge int) *[]*NewStarMessage {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	now := time.Now().Unix()
 	old := slices.Collect(func(yield func(star *NewStarMessage) bool) {
 		for _, newStarMessage := range db.content.NewStarMessages {
+			if newStarMessage.WebhookUrl != webhookUrl {
+				continue
+			}
 			age := now - newStarMessage.PostedTimestamp
 			if age > int64(maxAge) {
 				yield(&newStarMessage)
@@ -93,6 +368,7 @@ func Load(filePath string) (*Database, error) {
 			log.Println(err)
 			return nil, fmt.Errorf("failed to unmarshal db file content: %w", err)
 		}
+		migrateDatabaseContent(&dbContent)
 	}
 
 	return &Database{
@@ -109,6 +385,8 @@ func (db *Database) SaveUnsafe() {
 }
 
 func (db *Database) Save() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
 	dbContent, err := json.Marshal(db.content)
 	if err != nil {
 		return fmt.Errorf("failed to marshal db contents: %w", err)
@@ -122,7 +400,31 @@ func (db *Database) Save() error {
 
 func createNewDatabaseContent() DatabaseContent {
 	return DatabaseContent{
-		ListingMessages: make(map[string]string),
+		ListingMessages: make(map[string]MessageIds),
 		NewStarMessages: make([]NewStarMessage, 0),
+		LastMentions:    make(map[string]int64),
+		DigestEntries:   make([]DigestEntry, 0),
+		LastDigests:     make(map[string]int64),
+		RecentStars:     make([]RecentStar, 0),
+		Outbox:          make([]OutboxEntry, 0),
+		ListingThreads:  make(map[string]string),
+		RetainedTopics:  make([]string, 0),
+	}
+}
+
+// migrateDatabaseContent initializes content added after the db file was
+// first created.
+func migrateDatabaseContent(dbContent *DatabaseContent) {
+	if dbContent.ListingMessages == nil {
+		dbContent.ListingMessages = make(map[string]MessageIds)
+	}
+	if dbContent.LastMentions == nil {
+		dbContent.LastMentions = make(map[string]int64)
+	}
+	if dbContent.ListingThreads == nil {
+		dbContent.ListingThreads = make(map[string]string)
+	}
+	if dbContent.LastDigests == nil {
+		dbContent.LastDigests = make(map[string]int64)
 	}
 }
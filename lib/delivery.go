@@ -0,0 +1,68 @@
+package lib
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+type deliveryJob struct {
+	run   func(ctx context.Context)
+	batch *sync.WaitGroup
+}
+
+// DeliveryPool runs deliveries to different webhooks in parallel. Every
+// webhook has its own queue, so operations to the same webhook still run in
+// the order they were submitted, while at most concurrency deliveries run at
+// once. Each delivery is cancelled after the timeout.
+type DeliveryPool struct {
+	lock    sync.Mutex
+	queues  map[string]chan deliveryJob
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+func NewDeliveryPool(concurrency int, timeout time.Duration) *DeliveryPool {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &DeliveryPool{
+		queues:  make(map[string]chan deliveryJob),
+		slots:   make(chan struct{}, concurrency),
+		timeout: timeout,
+	}
+}
+
+// Deliver queues run for the webhook and adds it to the batch, which can be
+// waited on to know when all deliveries of the batch have finished.
+func (pool *DeliveryPool) Deliver(batch *sync.WaitGroup, webhookUrl string, run func(ctx context.Context)) {
+	batch.Add(1)
+	pool.queue(webhookUrl) <- deliveryJob{run: run, batch: batch}
+}
+
+func (pool *DeliveryPool) queue(webhookUrl string) chan deliveryJob {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+	queue, ok := pool.queues[webhookUrl]
+	if !ok {
+		queue = make(chan deliveryJob, 64)
+		pool.queues[webhookUrl] = queue
+		go pool.work(webhookUrl, queue)
+	}
+	return queue
+}
+
+func (pool *DeliveryPool) work(webhookUrl string, queue chan deliveryJob) {
+	for job := range queue {
+		pool.slots <- struct{}{}
+		ctx, cancel := context.WithTimeout(context.Background(), pool.timeout)
+		job.run(ctx)
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("Delivery to %s timed out after %v\n", webhookUrl, pool.timeout)
+		}
+		cancel()
+		<-pool.slots
+		job.batch.Done()
+	}
+}
@@ -0,0 +1,96 @@
+package lib
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliveryPoolKeepsOrderPerWebhook(t *testing.T) {
+	pool := NewDeliveryPool(4, time.Second)
+	webhookUrls := []string{"https://example.org/1", "https://example.org/2", "https://example.org/3"}
+
+	var lock sync.Mutex
+	delivered := make(map[string][]int)
+	var batch sync.WaitGroup
+	for index := 0; index < 20; index++ {
+		for _, webhookUrl := range webhookUrls {
+			pool.Deliver(&batch, webhookUrl, func(ctx context.Context) {
+				// later jobs finish faster, which would reorder parallel jobs
+				time.Sleep(time.Duration(20-index) * 100 * time.Microsecond)
+				lock.Lock()
+				delivered[webhookUrl] = append(delivered[webhookUrl], index)
+				lock.Unlock()
+			})
+		}
+	}
+	batch.Wait()
+
+	for _, webhookUrl := range webhookUrls {
+		if !slices.IsSorted(delivered[webhookUrl]) || len(delivered[webhookUrl]) != 20 {
+			t.Errorf("deliveries to %s out of order: %v", webhookUrl, delivered[webhookUrl])
+		}
+	}
+}
+
+func TestDeliveryPoolConcurrency(t *testing.T) {
+	for _, concurrency := range []int{1, 3} {
+		t.Run(fmt.Sprint(concurrency), func(t *testing.T) {
+			pool := NewDeliveryPool(concurrency, time.Second)
+
+			var running, maxRunning atomic.Int32
+			var batch sync.WaitGroup
+			for index := 0; index < 6; index++ {
+				pool.Deliver(&batch, fmt.Sprintf("https://example.org/%d", index), func(ctx context.Context) {
+					current := running.Add(1)
+					for {
+						seen := maxRunning.Load()
+						if current <= seen || maxRunning.CompareAndSwap(seen, current) {
+							break
+						}
+					}
+					time.Sleep(20 * time.Millisecond)
+					running.Add(-1)
+				})
+			}
+			batch.Wait()
+
+			// different webhooks are delivered to in parallel, up to the limit
+			if maxRunning.Load() != int32(concurrency) {
+				t.Errorf("expected %d deliveries at once, got %d", concurrency, maxRunning.Load())
+			}
+		})
+	}
+}
+
+func TestDeliveryPoolTimeout(t *testing.T) {
+	pool := NewDeliveryPool(1, 50*time.Millisecond)
+
+	var err error
+	var batch sync.WaitGroup
+	start := time.Now()
+	pool.Deliver(&batch, "https://example.org/1", func(ctx context.Context) {
+		<-ctx.Done()
+		err = ctx.Err()
+	})
+	// the next delivery to the webhook runs after the timed out one
+	next := false
+	pool.Deliver(&batch, "https://example.org/1", func(ctx context.Context) {
+		next = ctx.Err() == nil
+	})
+	batch.Wait()
+
+	if err != context.DeadlineExceeded {
+		t.Errorf("delivery was not cancelled after the timeout: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timed out delivery took %v", elapsed)
+	}
+	if !next {
+		t.Error("delivery after the timed out one did not run with a fresh context")
+	}
+}
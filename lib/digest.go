@@ -0,0 +1,84 @@
+package lib
+
+import (
+	"log"
+	"star-notifier/lib/db"
+)
+
+const (
+	DeliveryImmediate = "immediate"
+	DeliveryDigest    = "digest"
+)
+
+func (webhook *Webhook) IsDigest() bool {
+	return webhook.Delivery == DeliveryDigest
+}
+
+func (notifier *DiscordNotifier) queueDigestStars(webhook *Webhook, stars *[]*Star, timestamp int64) {
+	database := notifier.database
+	for _, star := range *stars {
+		database.AddDigestStar(webhook.Url, ToStarRecord(star), timestamp)
+	}
+	database.SaveUnsafe()
+
+	if webhook.DigestMaxStars > 0 && len(database.GetDigestStars(webhook.Url)) >= webhook.DigestMaxStars {
+		log.Println("Digest size threshold reached for", webhook.Url)
+		notifier.flushDigest(webhook, timestamp)
+	}
+}
+
+// isDigestDue tells whether the webhook delivers digests and its interval has
+// passed since the previous digest.
+func isDigestDue(webhook *Webhook, timestamp int64, database *db.Database) bool {
+	if !webhook.IsDigest() {
+		return false
+	}
+	return timestamp-database.GetLastDigest(webhook.Url) >= int64(webhook.DigestInterval*60)
+}
+
+// flushDigest moves the buffered stars of a webhook that have not depleted
+// yet to the outbox as a single new star message. Digests are kept until
+// deleted by hand, as they list stars from the whole interval.
+func (notifier *DiscordNotifier) flushDigest(webhook *Webhook, timestamp int64) {
+	database := notifier.database
+	stars := restoreStars(database.GetDigestStars(webhook.Url), timestamp)
+	if len(*stars) > 0 {
+		log.Printf("Posting digest of %d star(s) to %s\n", len(*stars), webhook.Url)
+		notifier.queueNewStars(webhook, stars, timestamp, true)
+	}
+	database.ClearDigest(webhook.Url, timestamp)
+	database.SaveUnsafe()
+}
+
+func ToStarRecord(star *Star) db.StarRecord {
+	return db.StarRecord{
+		Location:       star.Location,
+		CalledLocation: star.CalledLocation,
+		Tier:           star.Tier,
+		World:          star.World,
+		CalledAt:       star.CalledAt,
+		MinTime:        star.MinTime,
+		MaxTime:        star.MaxTime,
+		DepleteTime:    star.DepleteTime,
+	}
+}
+
+// FromStarRecord restores a stored star, returning nil if its called location
+// is no longer in the catalog.
+func FromStarRecord(record db.StarRecord) *Star {
+	mappedLocation := GetStarLocation(record.CalledLocation)
+	if mappedLocation == nil {
+		return nil
+	}
+	return &Star{
+		Location:       record.Location,
+		CalledLocation: record.CalledLocation,
+		MappedLocation: mappedLocation,
+		Tier:           record.Tier,
+		World:          record.World,
+		CalledAt:       record.CalledAt,
+		MinTime:        record.MinTime,
+		MaxTime:        record.MaxTime,
+		DepleteTime:    record.DepleteTime,
+	}
+}
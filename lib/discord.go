@@ -2,12 +2,11 @@ package lib
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	mapLib "github.com/cubeee/ent-notifier/lib"
-	"image/png"
-	"io"
 	"log"
+	"math"
 	"mime/multipart"
 	"net/http"
 	"slices"
@@ -15,272 +14,601 @@ import (
 	"star-notifier/lib/db"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
 )
 
-func getWebhookUrl(url string) (string, *string) {
-	if strings.Contains(url, "=") {
-		parts := strings.Split(url, "=")
-		url := parts[0]
-		roleId := parts[1]
-		return url, &roleId
+const (
+	maxContentLength = 2000
+	maxAttachments   = 10
+	maxEmbeds        = 10
+	maxEmbedFields   = 25
+	maxEmbedStars    = (maxEmbedFields - 1) / 3
+	maxEmbedsLength  = 6000
+	maxActionRows    = 5
+)
+
+type DiscordNotifier struct {
+	webhooks []*Webhook
+	database *db.Database
+	pool     *DeliveryPool
+}
+
+func NewDiscordNotifier(webhooks []*Webhook, database *db.Database) *DiscordNotifier {
+	// webhooks that were removed or disabled get no new messages, but the
+	// messages already posted are still deleted
+	database.RemoveOutboxEntries(func(entry db.OutboxEntry) bool {
+		return entry.Kind != OutboxDelete && !slices.ContainsFunc(GetEnabledWebhooks(webhooks), func(webhook *Webhook) bool {
+			return webhook.Url == entry.WebhookUrl
+		})
+	})
+	return &DiscordNotifier{
+		webhooks: webhooks,
+		database: database,
+		pool:     NewDeliveryPool(DeliveryConcurrency, time.Duration(DeliveryTimeout)*time.Second),
 	}
-	return url, nil
 }
 
-func PostStarListing(currentStars *[]*Star, webhookUrls []string, database *db.Database) error {
-	listingMessage, err := createCurrentStarsMessage(currentStars)
-	if err != nil {
-		return fmt.Errorf("failed to create listing message: %f", err)
+func (notifier *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+// deliver runs the delivery for every enabled webhook through the pool and
+// waits for all of them to finish.
+func (notifier *DiscordNotifier) deliver(run func(ctx context.Context, webhook *Webhook)) {
+	notifier.deliverTo(GetEnabledWebhooks(notifier.webhooks), run)
+}
+
+func (notifier *DiscordNotifier) deliverTo(webhooks []*Webhook, run func(ctx context.Context, webhook *Webhook)) {
+	var batch sync.WaitGroup
+	for _, webhook := range webhooks {
+		notifier.pool.Deliver(&batch, webhook.Url, func(ctx context.Context) {
+			run(ctx, webhook)
+		})
 	}
+	batch.Wait()
+}
 
-	for _, url := range webhookUrls {
-		if len(url) == 0 {
-			continue
+func (notifier *DiscordNotifier) PostListing(currentStars *[]*Star) error {
+	timestamp := time.Now().Unix()
+	notifier.deliver(func(ctx context.Context, webhook *Webhook) {
+		// the old pages are deleted, and without stored listing messages new
+		// ones are posted
+		database := notifier.database
+		threadId, known := database.GetListingThread(webhook.Url)
+		if !known {
+			threadId = webhook.ThreadId
 		}
-		url, _ = getWebhookUrl(url)
+		for _, messageId := range database.GetListingMessages(webhook.Url) {
+			notifier.enqueue(newDeleteEntry(&db.NewStarMessage{WebhookUrl: webhook.Url, MessageId: messageId, ThreadId: threadId}, timestamp))
+		}
+		database.SetListingMessages(webhook.Url, nil)
+		database.SetListingThread(webhook.Url, "")
+		notifier.enqueue(newListingEntry(webhook, webhook.Filters.Apply(currentStars), timestamp))
+		notifier.processOutbox(ctx, webhook, timestamp)
+	})
+	return nil
+}
+
+func (notifier *DiscordNotifier) UpdateListing(currentStars *[]*Star) error {
+	timestamp := time.Now().Unix()
+	notifier.deliver(func(ctx context.Context, webhook *Webhook) {
+		notifier.enqueue(newListingEntry(webhook, webhook.Filters.Apply(currentStars), timestamp))
+		notifier.processOutbox(ctx, webhook, timestamp)
+	})
+	return nil
+}
 
-		listingMessageId := database.GetListingMessage(url)
-		if listingMessageId == nil || len(*listingMessageId) == 0 {
-			log.Println("Listing message does not exist for url", url, "-- posting new message...")
-			postListingMessage(listingMessage, url, database)
+func (notifier *DiscordNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	notifier.deliver(func(ctx context.Context, webhook *Webhook) {
+		filteredStars := webhook.Filters.Apply(stars)
+		if len(*filteredStars) == 0 {
+			return
+		}
+		if webhook.IsDigest() {
+			notifier.queueDigestStars(webhook, filteredStars, timestamp)
 		} else {
-			log.Println("Listing message stored for", url, "-- updating...")
-			statusCode, err := editMessage(url, *listingMessageId, listingMessage)
-			if err != nil {
-				if statusCode == http.StatusNotFound {
-					log.Println("Failed to edit listing message to", url, "-- posting new listing message")
-					log.Println(err)
-					postListingMessage(listingMessage, url, database)
-				} else {
-					log.Println("Failed to edit listing message to url", url, "--", err)
-				}
-			}
+			notifier.queueNewStars(webhook, filteredStars, timestamp, false)
 		}
-	}
+		notifier.processOutbox(ctx, webhook, timestamp)
+	})
 	return nil
 }
 
-func PostNewStars(stars *[]*Star, webhookUrls []string, timestamp int64, database *db.Database) error {
-	for _, url := range webhookUrls {
-		if len(url) == 0 {
+// RetractMessages deletes the new star messages older than the max age of
+// their webhook. Messages of webhooks that were removed or disabled since are
+// deleted after NEW_STAR_MESSAGE_MAX_AGE.
+func (notifier *DiscordNotifier) RetractMessages(timestamp int64) error {
+	database := notifier.database
+	for _, webhookUrl := range database.GetNewStarMessageWebhooks() {
+		// the other notifiers store their messages under "<name>:" keys
+		if !isWebhookUrl(webhookUrl) {
 			continue
 		}
-		url, roleId := getWebhookUrl(url)
-		message, err := createNewStarMessage(stars, roleId)
-		if err != nil {
-			log.Println(fmt.Sprintf("failed to create new star message for %s: %f", url, err))
+		oldMessages := database.GetOldNewStarMessages(webhookUrl, notifier.messageMaxAge(webhookUrl))
+		if len(*oldMessages) == 0 {
 			continue
 		}
-		postNewStarMessage(message, url, timestamp, database)
+
+		log.Printf("Removing %d old message(s) from %s\n", len(*oldMessages), webhookUrl)
+		for _, message := range *oldMessages {
+			database.SetOutboxEntry(newDeleteEntry(message, timestamp))
+		}
+		database.RemoveNewStarMessages(oldMessages)
+		database.SaveUnsafe()
 	}
+
+	notifier.deliverTo(notifier.outboxWebhooks(), func(ctx context.Context, webhook *Webhook) {
+		notifier.processOutbox(ctx, webhook, timestamp)
+	})
 	return nil
 }
 
-func postListingMessage(message *DiscordMessage, webhookUrl string, database *db.Database) {
-	messageId, err := postMessage(webhookUrl, message)
-	if err != nil {
-		log.Println("Failed to post listing webhook to url", webhookUrl, err)
-	}
-	if len(messageId) > 0 {
-		database.SetListingMessage(webhookUrl, messageId)
-		database.SaveUnsafe()
+func (notifier *DiscordNotifier) messageMaxAge(webhookUrl string) int {
+	for _, webhook := range GetEnabledWebhooks(notifier.webhooks) {
+		if webhook.Url == webhookUrl {
+			return webhook.MessageMaxAge
+		}
 	}
+	return NewStarMessageMaxAge
 }
 
-func postNewStarMessage(message *DiscordMessage, webhookUrl string, timestamp int64, database *db.Database) {
-	messageId, err := postMessage(webhookUrl, message)
-	if err != nil {
-		log.Println("Failed to post new star webhook to url", webhookUrl, err)
-	}
-	if len(messageId) > 0 {
-		database.AddNewStarMessage(webhookUrl, messageId, timestamp)
-		database.SaveUnsafe()
+// outboxWebhooks returns the enabled webhooks, and the removed or disabled
+// webhooks that still have messages to delete.
+func (notifier *DiscordNotifier) outboxWebhooks() []*Webhook {
+	webhooks := GetEnabledWebhooks(notifier.webhooks)
+	for _, webhookUrl := range notifier.database.GetOutboxWebhooks() {
+		if !slices.ContainsFunc(webhooks, func(webhook *Webhook) bool {
+			return webhook.Url == webhookUrl
+		}) {
+			webhooks = append(webhooks, &Webhook{Url: webhookUrl})
+		}
 	}
+	return webhooks
 }
 
-func createNewStarMessage(stars *[]*Star, roleId *string) (*DiscordMessage, error) {
-	var lines []string
-	sort.Slice(*stars, func(a, b int) bool {
-		return (*stars)[b].DepleteTime < (*stars)[a].DepleteTime
+// hasDiscordMessages tells whether posted messages are still to be deleted,
+// which needs the notifier even when no webhooks are configured anymore.
+func hasDiscordMessages(database *db.Database) bool {
+	return len(database.GetOutboxWebhooks()) > 0 || slices.ContainsFunc(database.GetNewStarMessageWebhooks(), isWebhookUrl)
+}
+
+func isWebhookUrl(webhookUrl string) bool {
+	return strings.HasPrefix(webhookUrl, "https://") || strings.HasPrefix(webhookUrl, "http://")
+}
+
+// Tick flushes due digests and retries failed deliveries, which also resumes
+// the deliveries left pending by a restart.
+func (notifier *DiscordNotifier) Tick(timestamp int64) error {
+	notifier.deliver(func(ctx context.Context, webhook *Webhook) {
+		if isDigestDue(webhook, timestamp, notifier.database) {
+			notifier.flushDigest(webhook, timestamp)
+		}
+		notifier.processOutbox(ctx, webhook, timestamp)
 	})
+	return nil
+}
 
-	if roleId != nil {
-		lines = append(lines, fmt.Sprintf("<@&%s>", *roleId))
+// createNewStarMessage creates the message announcing new stars. Temporary
+// messages are deleted after a while and point to the listing instead.
+func createNewStarMessage(stars *[]*Star, roleIds []string, webhook *Webhook, temporary bool) (*DiscordMessage, error) {
+	var lines []string
+	stars = sortedStars(stars)
+
+	if len(roleIds) > 0 {
+		lines = append(lines, formatRoleMentions(roleIds))
 	}
 
 	for _, star := range *stars {
-		lines = append(lines, fmt.Sprintf(
-			"[NEW STAR] World %d, tier %d, %s (est. depletion: %s)",
-			star.World,
-			star.Tier,
-			star.CalledLocation,
-			fmt.Sprintf("<t:%d:R>", star.DepleteTime),
-		))
+		lines = append(lines, formatNewStarLine(star, webhook.Format))
 	}
 
-	lines = append(lines, "-# This is a temporary message to get your attention, use the listing")
+	if temporary {
+		lines = append(lines, "-# This is a temporary message to get your attention, use the listing")
+	}
 
 	content := strings.Join(lines, "\n")
 
 	message := &DiscordMessage{
-		Content: content,
+		Content:    content,
+		Components: createStarButtons(*stars),
 	}
+	webhook.GetNewStarIdentity(stars).apply(message, stars)
 	return message, nil
 }
 
-func createCurrentStarsMessage(stars *[]*Star) (*DiscordMessage, error) {
-	content := ""
-	footer := ""
-	if len(ListingFooter) > 0 {
-		footer = "\n-# " + ListingFooter
+// createListingMessages creates the pages of the listing, splitting the
+// stars across as many messages as needed to stay within the content length
+// and attachment limits. The footer is added to the last page.
+func createListingMessages(stars *[]*Star, webhook *Webhook) ([]*DiscordMessage, error) {
+	createMessages := createTextListingMessages
+	if webhook.Format == FormatEmbed {
+		createMessages = createEmbedListingMessages
+	}
+	messages, err := createMessages(stars, webhook)
+	if err != nil {
+		return nil, err
 	}
+	// edits keep the username and avatar the page was posted with, so the
+	// identity only applies to newly posted pages
+	for _, message := range messages {
+		webhook.ListingIdentity.apply(message, stars)
+	}
+	return messages, nil
+}
 
-	var files []DiscordFile
-	var attachments []DiscordAttachment
-	var starLocations []*StarLocation
+func createTextListingMessages(stars *[]*Star, webhook *Webhook) ([]*DiscordMessage, error) {
+	footer := ""
+	if len(*webhook.ListingFooter) > 0 {
+		footer = "\n-# " + *webhook.ListingFooter
+	}
 
-	sort.Slice(*stars, func(a, b int) bool {
-		return (*stars)[b].DepleteTime < (*stars)[a].DepleteTime
-	})
+	stars = sortedStars(stars)
 
+	var messages []*DiscordMessage
+	content := ""
+	var starLocations []*StarLocation
+	var pageStars []*Star
 	if len(*stars) == 0 {
 		content += "No stars at the moment :(\n"
 	}
 
 	for _, star := range *stars {
-		line := fmt.Sprintf(
-			"[World %d, tier %d] %s (est. depletion: %s)",
-			star.World,
-			star.Tier,
-			star.CalledLocation,
-			fmt.Sprintf("<t:%d:R>", star.DepleteTime),
-		)
-
-		if len(content)+len(line)+len(footer) > 2000 {
-			break
+		line := formatListingLine(star, webhook.Format)
+
+		newLocation := !slices.ContainsFunc(starLocations, func(location *StarLocation) bool {
+			return *location == *star.MappedLocation
+		})
+		if len(content)+len(line)+len(footer) > maxContentLength || (newLocation && len(starLocations) == maxAttachments) {
+			messages = append(messages, createListingPage(content, starLocations, pageStars, webhook))
+			content = ""
+			starLocations = nil
+			pageStars = nil
+			newLocation = true
 		}
 
 		content += line + "\n"
+		pageStars = append(pageStars, star)
 
-		if !slices.Contains(starLocations, star.MappedLocation) {
+		if newLocation {
 			starLocations = append(starLocations, star.MappedLocation)
 		}
 	}
 
+	messages = append(messages, createListingPage(content+footer, starLocations, pageStars, webhook))
+	return messages, nil
+}
+
+func createListingPage(content string, starLocations []*StarLocation, stars []*Star, webhook *Webhook) *DiscordMessage {
+	var files []DiscordFile
 	for _, location := range starLocations {
 		x := location.X
 		y := location.Y
 		fileId := fmt.Sprintf("%d_%d.png", x, y)
 		imageName := fmt.Sprintf("map%d_%d.png", x, y)
 
-		if mapImage, err := mapLib.CreateThumbnail(x, y, MapWidth, MapHeight); err == nil {
-			buffer := new(bytes.Buffer)
-			err = png.Encode(buffer, mapImage)
-			if err != nil {
-				continue
-			}
-
-			imageBuffer := buffer.Bytes()
+		if imageBuffer, err := GetThumbnail(x, y, webhook.MapWidth, webhook.MapHeight); err == nil {
 			files = append(files, DiscordFile{
 				Id:   &fileId,
 				Name: imageName,
 				Data: &imageBuffer,
 			})
-			attachments = append(attachments, DiscordAttachment{
-				Id:          fileId,
-				FileName:    imageName,
-				Description: imageName,
-			})
 		}
 	}
 
-	if len(footer) > 0 {
-		content = content + footer
+	return &DiscordMessage{
+		Content:    content,
+		Files:      &files,
+		Components: createStarButtons(stars),
 	}
+}
 
-	message := &DiscordMessage{
-		Content: content,
-		Files:   &files,
+// createEmbedListingMessages creates an embed for every location with stars,
+// coloured by the highest tier at the location and showing its map thumbnail.
+// Discord allows at most 10 embeds in a message, further locations continue
+// on the next page.
+func createEmbedListingMessages(stars *[]*Star, webhook *Webhook) ([]*DiscordMessage, error) {
+	stars = sortedStars(stars)
+
+	var starLocations []*StarLocation
+	locationStars := make(map[StarLocation][]*Star)
+	for _, star := range *stars {
+		if _, ok := locationStars[*star.MappedLocation]; !ok {
+			starLocations = append(starLocations, star.MappedLocation)
+		}
+		locationStars[*star.MappedLocation] = append(locationStars[*star.MappedLocation], star)
 	}
 
-	return message, nil
+	messages := []*DiscordMessage{{Embeds: &[]DiscordEmbed{}, Files: &[]DiscordFile{}}}
+	pageStars := make([][]*Star, 1)
+	pageLength := 0
+	for _, location := range starLocations {
+		fileId := fmt.Sprintf("%d_%d.png", location.X, location.Y)
+		imageName := fmt.Sprintf("map%d_%d.png", location.X, location.Y)
+		imageBuffer, imageErr := GetThumbnail(location.X, location.Y, webhook.MapWidth, webhook.MapHeight)
+
+		starsAtLocation := locationStars[*location]
+		for index, embed := range createLocationEmbeds(location, starsAtLocation) {
+			// the text of all embeds and their fields is limited per message
+			length := embedLength(embed)
+			if embeds := len(*messages[len(messages)-1].Embeds); embeds == maxEmbeds || (embeds > 0 && pageLength+length > maxEmbedsLength) {
+				messages = append(messages, &DiscordMessage{Embeds: &[]DiscordEmbed{}, Files: &[]DiscordFile{}})
+				pageStars = append(pageStars, nil)
+				pageLength = 0
+			}
+			pageLength += length
+			message := messages[len(messages)-1]
+
+			// the thumbnail is shown in the first embed of the location
+			if index == 0 && imageErr == nil {
+				*message.Files = append(*message.Files, DiscordFile{
+					Id:   &fileId,
+					Name: imageName,
+					Data: &imageBuffer,
+				})
+				embed.Image = &DiscordEmbedImage{Url: "attachment://" + imageName}
+			}
+			*message.Embeds = append(*message.Embeds, embed)
+			embedStars := starsAtLocation[index*maxEmbedStars : min((index+1)*maxEmbedStars, len(starsAtLocation))]
+			pageStars[len(pageStars)-1] = append(pageStars[len(pageStars)-1], embedStars...)
+		}
+	}
+	for index, message := range messages {
+		message.Components = createStarButtons(pageStars[index])
+	}
+
+	last := messages[len(messages)-1]
+	if len(*stars) == 0 {
+		last.Content = "No stars at the moment :("
+	}
+	if len(*webhook.ListingFooter) > 0 {
+		last.Content = strings.TrimPrefix(last.Content+"\n-# "+*webhook.ListingFooter, "\n")
+	}
+	return messages, nil
 }
 
-func postMessage(webhookUrl string, message *DiscordMessage) (string, error) {
-	url := fmt.Sprintf("%s?wait=true", webhookUrl)
+// createLocationEmbeds creates the embeds of a location, holding three fields
+// for every star and a link to the location. An embed holds at most 25
+// fields, so the stars continue in further embeds.
+func createLocationEmbeds(location *StarLocation, stars []*Star) []DiscordEmbed {
+	maxTier := 0
+	for _, star := range stars {
+		maxTier = max(maxTier, star.Tier)
+	}
 
-	payload, contentType, err := encodeMessage(message)
-	if err != nil {
-		return "", fmt.Errorf("failed to encode message: %f", err)
+	region := GetRegionName(stars[0].Location, location)
+	if len(region) == 0 {
+		region = location.Name
+	}
+	description := ""
+	if distance := stars[0].NearestHomePoint(); distance != nil {
+		description = distance.String()
 	}
 
-	resp, err := http.Post(url, contentType, payload)
-	if err != nil {
-		return "", fmt.Errorf("failed to post message: %f", err)
+	var embeds []DiscordEmbed
+	for start := 0; start < len(stars); start += maxEmbedStars {
+		var fields []DiscordEmbedField
+		for _, star := range stars[start:min(start+maxEmbedStars, len(stars))] {
+			fields = append(fields,
+				DiscordEmbedField{Name: "World", Value: strconv.Itoa(star.World), Inline: true},
+				DiscordEmbedField{Name: "Tier", Value: strconv.Itoa(star.Tier), Inline: true},
+				DiscordEmbedField{Name: "Depletion", Value: fmt.Sprintf("<t:%d:R>", star.DepleteTime), Inline: true},
+			)
+		}
+		fields = append(fields, DiscordEmbedField{Name: "Location", Value: fmt.Sprintf("[%s](%s)", region, MapUrl(location))})
+
+		embed := DiscordEmbed{
+			Title:       stars[0].CalledLocation,
+			Description: description,
+			Color:       tierColor(maxTier),
+			Fields:      &fields,
+		}
+		if start > 0 {
+			embed.Title += " (continued)"
+			embed.Description = ""
+		}
+		embeds = append(embeds, embed)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			panic(err)
+	return embeds
+}
+
+// embedLength counts the characters of an embed that count towards the limit
+// of a message.
+func embedLength(embed DiscordEmbed) int {
+	length := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range *embed.Fields {
+		length += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	return length
+}
+
+// tierColor goes from grey for the lowest tiers through green and gold to red
+// for the highest tiers.
+func tierColor(tier int) int {
+	colors := []int{0x95a5a6, 0x95a5a6, 0x2ecc71, 0x1abc9c, 0x3498db, 0x9b59b6, 0xf1c40f, 0xe67e22, 0xe74c3c}
+	return colors[max(1, min(tier, len(colors)))-1]
+}
+
+// createStarButtons creates a row of link buttons to the map and world of
+// each star, the first row also linking to the wiki. Discord allows at most 5
+// rows in a message, stars after those get no buttons.
+func createStarButtons(stars []*Star) *[]DiscordComponent {
+	rows := []DiscordComponent{}
+	for _, star := range stars[:min(len(stars), maxActionRows)] {
+		buttons := []DiscordComponent{
+			createLinkButton(fmt.Sprintf("Map: %s", star.CalledLocation), MapUrl(star.MappedLocation)),
+			createLinkButton(fmt.Sprintf("World %d (%s)", star.World, GetWorldType(star.World)), WorldUrl(star.World)),
+		}
+		if len(rows) == 0 {
+			buttons = append(buttons, createLinkButton("Wiki", WikiUrl))
+		}
+		rows = append(rows, DiscordComponent{
+			Type:       ComponentTypeActionRow,
+			Components: &buttons,
+		})
+	}
+	return &rows
+}
+
+func createLinkButton(label, url string) DiscordComponent {
+	return DiscordComponent{
+		Type:  ComponentTypeButton,
+		Style: ButtonStyleLink,
+		// button labels are limited to 80 characters
+		Label: truncate(label, 80),
+		Url:   url,
+	}
+}
+
+func formatRoleMentions(roleIds []string) string {
+	var mentions []string
+	for _, roleId := range roleIds {
+		mentions = append(mentions, fmt.Sprintf("<@&%s>", roleId))
+	}
+	return strings.Join(mentions, " ")
+}
+
+func formatNewStarLine(star *Star, format string) string {
+	if format == FormatCompact {
+		return fmt.Sprintf("[NEW] W%d T%d %s <t:%d:R>", star.World, star.Tier, star.CalledLocation, star.DepleteTime)
+	}
+	return fmt.Sprintf(
+		"[NEW STAR] World %d, tier %d, %s (est. depletion: %s)%s",
+		star.World,
+		star.Tier,
+		star.CalledLocation,
+		fmt.Sprintf("<t:%d:R>", star.DepleteTime),
+		formatHomePointDistance(star),
+	)
+}
+
+func formatListingLine(star *Star, format string) string {
+	if format == FormatCompact {
+		return fmt.Sprintf("W%d T%d %s <t:%d:R>", star.World, star.Tier, star.CalledLocation, star.DepleteTime)
+	}
+	return fmt.Sprintf(
+		"[World %d, tier %d] %s (est. depletion: %s)%s",
+		star.World,
+		star.Tier,
+		star.CalledLocation,
+		fmt.Sprintf("<t:%d:R>", star.DepleteTime),
+		formatHomePointDistance(star),
+	)
+}
+
+// sortedStars returns a sorted copy of the stars, leaving the list shared by
+// the notifiers as it is.
+func sortedStars(stars *[]*Star) *[]*Star {
+	sorted := slices.Clone(*stars)
+	byProximity := SortByProximity && len(HomePoints) > 0
+	sort.Slice(sorted, func(a, b int) bool {
+		starA, starB := sorted[a], sorted[b]
+		if byProximity {
+			if proximityA, proximityB := proximity(starA), proximity(starB); proximityA != proximityB {
+				return proximityA < proximityB
+			}
+		}
+		// the stars depleting last come first, ties go to the higher tier
+		if starA.DepleteTime != starB.DepleteTime {
+			return starA.DepleteTime > starB.DepleteTime
 		}
-	}(resp.Body)
+		if starA.Tier != starB.Tier {
+			return starA.Tier > starB.Tier
+		}
+		return starA.World < starB.World
+	})
+	return &sorted
+}
+
+func proximity(star *Star) int {
+	if distance := star.NearestHomePoint(); distance != nil {
+		return distance.Tiles
+	}
+	return math.MaxInt
+}
+
+// postMessage posts the message, into the thread when threadId is set, and
+// returns the id of the message and of the channel or thread it was posted
+// in. Messages with a ThreadName create a new forum post.
+func postMessage(ctx context.Context, webhookUrl, threadId string, message *DiscordMessage) (string, string, error) {
+	// webhooks not owned by an application only send link buttons with
+	// with_components
+	url := withThread(fmt.Sprintf("%s?wait=true&with_components=true", webhookUrl), threadId)
+
+	payload, contentType, err := encodeMessage(message)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode message: %w", err)
+	}
 
-	body, err := io.ReadAll(resp.Body)
+	statusCode, body, err := discordClient.Do(ctx, http.MethodPost, url, contentType, payload.Bytes())
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %f", err)
+		return "", "", fmt.Errorf("failed to post message: %w", err)
+	}
+	if statusCode != http.StatusOK {
+		return "", "", fmt.Errorf("failed to post message: %w", &DiscordError{StatusCode: statusCode, Body: string(body)})
 	}
 
 	var jsonBody map[string]json.RawMessage
 	if err = json.Unmarshal(body, &jsonBody); err != nil {
-		return "", fmt.Errorf("failed to unmarshal response body: %f", err)
+		return "", "", fmt.Errorf("failed to unmarshal response body: %w", err)
 	}
 
-	var messageId string
+	var messageId, channelId string
 	if err = json.Unmarshal(jsonBody["id"], &messageId); err != nil {
-		return "", fmt.Errorf("failed to get message id from response body: %f, %v", err, string(body))
+		return "", "", fmt.Errorf("failed to get message id from response body: %w, %v", err, string(body))
+	}
+	if err = json.Unmarshal(jsonBody["channel_id"], &channelId); err != nil {
+		return "", "", fmt.Errorf("failed to get channel id from response body: %w, %v", err, string(body))
 	}
 
-	return messageId, nil
+	return messageId, channelId, nil
 }
 
-func editMessage(webhookUrl, messageId string, message *DiscordMessage) (int, error) {
+func editMessage(ctx context.Context, webhookUrl, threadId, messageId string, message *DiscordMessage) (int, error) {
 	payload, contentType, err := encodeMessage(message)
 	if err != nil {
-		return -1, fmt.Errorf("failed to encode edit message: %f", err)
-	}
-
-	url := fmt.Sprintf("%s/messages/%s", webhookUrl, messageId)
-	req, err := http.NewRequest(http.MethodPatch, url, payload)
-	if err != nil {
-		return -1, fmt.Errorf("failed to create edit message request: %f", err)
+		return -1, fmt.Errorf("failed to encode edit message: %w", err)
 	}
-	req.Header.Set("Content-Type", contentType)
 
-	resp, err := http.DefaultClient.Do(req)
+	url := withThread(fmt.Sprintf("%s/messages/%s?with_components=true", webhookUrl, messageId), threadId)
+	statusCode, body, err := discordClient.Do(ctx, http.MethodPatch, url, contentType, payload.Bytes())
 	if err != nil {
-		return -1, fmt.Errorf("failed to edit message: %f", err)
+		return -1, fmt.Errorf("failed to edit message: %w", err)
 	}
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return resp.StatusCode, fmt.Errorf("failed to edit webhook: %d", resp.StatusCode)
+	if statusCode != http.StatusOK && statusCode != http.StatusCreated {
+		return statusCode, fmt.Errorf("failed to edit webhook: %w", &DiscordError{StatusCode: statusCode, Body: string(body)})
 	}
 
-	return resp.StatusCode, nil
+	return statusCode, nil
 }
 
-func DeleteMessage(webhookUrl, messageId string) error {
-	url := fmt.Sprintf("%s/messages/%s", webhookUrl, messageId)
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+func deleteMessage(ctx context.Context, webhookUrl, threadId, messageId string) error {
+	url := withThread(fmt.Sprintf("%s/messages/%s", webhookUrl, messageId), threadId)
+	statusCode, body, err := discordClient.Do(ctx, http.MethodDelete, url, "", nil)
 	if err != nil {
-		return fmt.Errorf("failed to create delete message request: %f", err)
+		return fmt.Errorf("failed to delete message: %w", err)
 	}
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil || resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to delete message: %f (%d)", err, resp.StatusCode)
+	if statusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to delete message: %w", &DiscordError{StatusCode: statusCode, Body: string(body)})
 	}
 	return nil
 }
 
+// withThread adds the thread_id query parameter to a webhook url when a
+// thread is given.
+func withThread(url, threadId string) string {
+	if len(threadId) == 0 {
+		return url
+	}
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	return url + separator + "thread_id=" + threadId
+}
+
 func encodeMessage(message *DiscordMessage) (*bytes.Buffer, string, error) {
 	payload := new(bytes.Buffer)
 
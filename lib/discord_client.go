@@ -0,0 +1,217 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// messageIdPattern matches the message id part of webhook message urls, which
+// does not affect the rate limit bucket of the route.
+var messageIdPattern = regexp.MustCompile(`/messages/[0-9]+`)
+
+type discordBucket struct {
+	remaining int
+	resetAt   time.Time
+}
+
+type discordRateLimit struct {
+	RetryAfter float64 `json:"retry_after"`
+	Global     bool    `json:"global"`
+}
+
+// DiscordClient sends requests to the Discord api, waiting out the per-route
+// buckets announced in the X-RateLimit-* headers and the global rate limit.
+// 429 responses are retried after retry_after, 5xx responses and network
+// errors with exponential backoff.
+type DiscordClient struct {
+	lock        sync.Mutex
+	client      *http.Client
+	retries     int
+	routes      map[string]string
+	buckets     map[string]*discordBucket
+	globalUntil time.Time
+}
+
+var discordClient = NewDiscordClient(DiscordMaxRetries)
+
+func NewDiscordClient(retries int) *DiscordClient {
+	return &DiscordClient{
+		client:  notifierClient,
+		retries: retries,
+		routes:  make(map[string]string),
+		buckets: make(map[string]*discordBucket),
+	}
+}
+
+// Do sends the request and returns the status code and body of the last
+// response. Only network errors and exhausted retries are returned as errors,
+// other statuses are left for the caller to handle.
+func (client *DiscordClient) Do(ctx context.Context, method, url, contentType string, payload []byte) (int, []byte, error) {
+	route, major := discordRoute(method, url)
+
+	var err error
+	for attempt := 0; attempt <= client.retries; attempt++ {
+		if err := client.wait(ctx, route); err != nil {
+			return -1, nil, err
+		}
+
+		var statusCode int
+		var body []byte
+		var header http.Header
+		statusCode, header, body, err = client.send(ctx, method, url, contentType, payload)
+		if err != nil {
+			if ctx.Err() != nil {
+				return -1, nil, err
+			}
+			client.backoff(ctx, attempt)
+			continue
+		}
+		client.update(route, major, header)
+
+		switch {
+		case statusCode == http.StatusTooManyRequests:
+			client.limited(route, header, body)
+			err = fmt.Errorf("rate limited on %s", route)
+		case statusCode >= 500:
+			err = fmt.Errorf("unexpected status %d: %s", statusCode, string(body))
+			client.backoff(ctx, attempt)
+		default:
+			return statusCode, body, nil
+		}
+	}
+	return -1, nil, fmt.Errorf("giving up after %d attempt(s): %w", client.retries+1, err)
+}
+
+func (client *DiscordClient) send(ctx context.Context, method, url, contentType string, payload []byte) (int, http.Header, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return -1, nil, nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return -1, nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return -1, nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return resp.StatusCode, resp.Header, body, nil
+}
+
+// wait blocks until the global rate limit and the route's bucket allow
+// another request, or the context is done.
+func (client *DiscordClient) wait(ctx context.Context, route string) error {
+	client.lock.Lock()
+	until := client.globalUntil
+	if bucket := client.buckets[client.bucketId(route)]; bucket != nil && bucket.remaining <= 0 && bucket.resetAt.After(until) {
+		until = bucket.resetAt
+	}
+	client.lock.Unlock()
+
+	return sleepContext(ctx, time.Until(until))
+}
+
+func (client *DiscordClient) update(route, major string, header http.Header) {
+	bucketId := header.Get("X-RateLimit-Bucket")
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if len(bucketId) == 0 || err != nil {
+		return
+	}
+	resetAfter, _ := strconv.ParseFloat(header.Get("X-RateLimit-Reset-After"), 64)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	// buckets are shared between routes but still limited per webhook
+	bucketId += " " + major
+	client.routes[route] = bucketId
+	client.buckets[bucketId] = &discordBucket{
+		remaining: remaining,
+		resetAt:   time.Now().Add(secondsDuration(resetAfter)),
+	}
+}
+
+func (client *DiscordClient) limited(route string, header http.Header, body []byte) {
+	var rateLimit discordRateLimit
+	if err := json.Unmarshal(body, &rateLimit); err != nil || rateLimit.RetryAfter <= 0 {
+		rateLimit.RetryAfter, _ = strconv.ParseFloat(header.Get("Retry-After"), 64)
+	}
+	if rateLimit.RetryAfter <= 0 {
+		rateLimit.RetryAfter = 1
+	}
+	global := rateLimit.Global || header.Get("X-RateLimit-Global") == "true"
+	log.Printf("Rate limited on %s for %.2fs (global: %v)\n", route, rateLimit.RetryAfter, global)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	resetAt := time.Now().Add(secondsDuration(rateLimit.RetryAfter))
+	if global {
+		client.globalUntil = resetAt
+		return
+	}
+	bucketId := client.bucketId(route)
+	client.routes[route] = bucketId
+	client.buckets[bucketId] = &discordBucket{remaining: 0, resetAt: resetAt}
+}
+
+func (client *DiscordClient) backoff(ctx context.Context, attempt int) {
+	if attempt < client.retries {
+		_ = sleepContext(ctx, time.Duration(1<<attempt)*time.Second)
+	}
+}
+
+// bucketId returns the bucket shared by the route, or the route itself until
+// Discord has told which bucket it belongs to.
+func (client *DiscordClient) bucketId(route string) string {
+	if bucketId, ok := client.routes[route]; ok {
+		return bucketId
+	}
+	return route
+}
+
+// discordRoute returns the rate limit route of the request, which ignores
+// message ids and query parameters, and its major parameter, the webhook.
+func discordRoute(method, url string) (string, string) {
+	path, _, _ := strings.Cut(url, "?")
+	major := messageIdPattern.Split(path, 2)[0]
+	return method + " " + messageIdPattern.ReplaceAllString(path, "/messages/:id"), major
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
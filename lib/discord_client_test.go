@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type scriptedResponse struct {
+	status int
+	header map[string]string
+	body   string
+}
+
+// scriptedServer answers the requests in order with the given responses and
+// records when it received them. Requests after the last response get the
+// last response again.
+type scriptedServer struct {
+	*httptest.Server
+	lock      sync.Mutex
+	responses []scriptedResponse
+	times     []time.Time
+}
+
+func newScriptedServer(t *testing.T, responses ...scriptedResponse) *scriptedServer {
+	server := &scriptedServer{responses: responses}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.lock.Lock()
+		response := server.responses[min(len(server.times), len(server.responses)-1)]
+		server.times = append(server.times, time.Now())
+		server.lock.Unlock()
+
+		for key, value := range response.header {
+			writer.Header().Set(key, value)
+		}
+		writer.WriteHeader(response.status)
+		_, _ = writer.Write([]byte(response.body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *scriptedServer) requests() []time.Time {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	return server.times
+}
+
+func TestDiscordRoute(t *testing.T) {
+	for _, test := range []struct {
+		method, url  string
+		route, major string
+	}{
+		{
+			http.MethodPost, "https://discord.com/api/webhooks/1/token?wait=true&thread_id=2",
+			"POST https://discord.com/api/webhooks/1/token", "https://discord.com/api/webhooks/1/token",
+		},
+		{
+			http.MethodPatch, "https://discord.com/api/webhooks/1/token/messages/123?with_components=true",
+			"PATCH https://discord.com/api/webhooks/1/token/messages/:id", "https://discord.com/api/webhooks/1/token",
+		},
+		{
+			http.MethodDelete, "https://discord.com/api/webhooks/1/token/messages/456",
+			"DELETE https://discord.com/api/webhooks/1/token/messages/:id", "https://discord.com/api/webhooks/1/token",
+		},
+	} {
+		route, major := discordRoute(test.method, test.url)
+		if route != test.route || major != test.major {
+			t.Errorf("unexpected route %q and major %q for %s %s", route, major, test.method, test.url)
+		}
+	}
+}
+
+func TestDiscordClientUpdatesBuckets(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{
+		status: http.StatusOK,
+		header: map[string]string{
+			"X-RateLimit-Bucket":      "bucket",
+			"X-RateLimit-Remaining":   "0",
+			"X-RateLimit-Reset-After": "0.3",
+		},
+	})
+	client := NewDiscordClient(0)
+
+	for _, messageId := range []string{"1", "2"} {
+		statusCode, _, err := client.Do(context.Background(), http.MethodPatch, server.URL+"/webhooks/1/token/messages/"+messageId, "", nil)
+		if err != nil || statusCode != http.StatusOK {
+			t.Fatalf("unexpected status %d: %v", statusCode, err)
+		}
+	}
+
+	route, major := discordRoute(http.MethodPatch, server.URL+"/webhooks/1/token/messages/1")
+	if bucketId := client.bucketId(route); bucketId != "bucket "+major {
+		t.Errorf("route is not in the announced bucket: %q", bucketId)
+	}
+	// the bucket was exhausted, the second request waits for its reset
+	requests := server.requests()
+	if len(requests) != 2 || requests[1].Sub(requests[0]) < 250*time.Millisecond {
+		t.Errorf("second request did not wait for the bucket to reset: %v", requests)
+	}
+}
+
+func TestDiscordClientResponses(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		responses []scriptedResponse
+		retries   int
+		status    int
+		requests  int
+		minDelay  time.Duration
+		err       string
+	}{
+		{
+			name:      "client errors are returned",
+			responses: []scriptedResponse{{status: http.StatusNotFound, body: `{"message":"Unknown Message"}`}},
+			retries:   2,
+			status:    http.StatusNotFound,
+			requests:  1,
+		},
+		{
+			name: "rate limits are retried after retry_after",
+			responses: []scriptedResponse{
+				{status: http.StatusTooManyRequests, body: `{"retry_after":0.2,"global":false}`},
+				{status: http.StatusOK},
+			},
+			retries:  2,
+			status:   http.StatusOK,
+			requests: 2,
+			minDelay: 150 * time.Millisecond,
+		},
+		{
+			name: "global rate limits are retried after the Retry-After header",
+			responses: []scriptedResponse{
+				{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After": "0.2", "X-RateLimit-Global": "true"}},
+				{status: http.StatusOK},
+			},
+			retries:  2,
+			status:   http.StatusOK,
+			requests: 2,
+			minDelay: 150 * time.Millisecond,
+		},
+		{
+			name: "server errors are retried",
+			responses: []scriptedResponse{
+				{status: http.StatusBadGateway},
+				{status: http.StatusNoContent},
+			},
+			retries:  1,
+			status:   http.StatusNoContent,
+			requests: 2,
+			minDelay: 900 * time.Millisecond,
+		},
+		{
+			name:      "retries are exhausted",
+			responses: []scriptedResponse{{status: http.StatusTooManyRequests, body: `{"retry_after":0.05}`}},
+			retries:   2,
+			status:    -1,
+			requests:  3,
+			err:       "giving up after 3 attempt(s)",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newScriptedServer(t, test.responses...)
+			client := NewDiscordClient(test.retries)
+
+			statusCode, _, err := client.Do(context.Background(), http.MethodPost, server.URL+"/webhooks/1/token", "", nil)
+			if statusCode != test.status {
+				t.Errorf("unexpected status %d, expected %d", statusCode, test.status)
+			}
+			if (err == nil) != (len(test.err) == 0) || (err != nil && !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("unexpected error %v", err)
+			}
+			requests := server.requests()
+			if len(requests) != test.requests {
+				t.Fatalf("unexpected %d request(s), expected %d", len(requests), test.requests)
+			}
+			if delay := requests[len(requests)-1].Sub(requests[0]); delay < test.minDelay {
+				t.Errorf("retried after %v, expected at least %v", delay, test.minDelay)
+			}
+		})
+	}
+}
+
+func TestDiscordClientCancelled(t *testing.T) {
+	server := newScriptedServer(t, scriptedResponse{status: http.StatusTooManyRequests, body: `{"retry_after":10}`})
+	client := NewDiscordClient(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, err := client.Do(ctx, http.MethodPost, server.URL+"/webhooks/1/token", "", nil); err == nil {
+		t.Fatal("expected the rate limited request to fail when cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("cancelled request waited %v for the rate limit", elapsed)
+	}
+}
@@ -0,0 +1,366 @@
+package lib
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type discordRequest struct {
+	Method   string
+	Path     string
+	ThreadId string
+}
+
+// fakeDiscordServer answers webhook requests like Discord, numbering the
+// posted messages, and records the requests it received. The status function
+// can fail requests with another status.
+type fakeDiscordServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []discordRequest
+	posted   int
+	status   func(request discordRequest) int
+}
+
+func newFakeDiscordServer(t *testing.T) *fakeDiscordServer {
+	server := &fakeDiscordServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		recorded := discordRequest{Method: request.Method, Path: request.URL.Path, ThreadId: request.URL.Query().Get("thread_id")}
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		server.requests = append(server.requests, recorded)
+
+		if server.status != nil {
+			if status := server.status(recorded); status != http.StatusOK {
+				writer.WriteHeader(status)
+				_, _ = fmt.Fprintf(writer, `{"message":"status %d"}`, status)
+				return
+			}
+		}
+		switch request.Method {
+		case http.MethodPost:
+			server.posted++
+			channelId := recorded.ThreadId
+			if len(channelId) == 0 {
+				channelId = "channel"
+			}
+			_, _ = fmt.Fprintf(writer, `{"id":"%d","channel_id":"%s"}`, server.posted, channelId)
+		case http.MethodDelete:
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			_, _ = writer.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *fakeDiscordServer) take() []discordRequest {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	requests := server.requests
+	server.requests = nil
+	return requests
+}
+
+// testWebhook returns a webhook with the defaults applied and the thumbnails
+// of the locations cached, so that no map is rendered.
+func testWebhook(format string, locations ...*StarLocation) *Webhook {
+	webhook := &Webhook{Url: "https://discord.com/api/webhooks/1/token", Format: format}
+	webhook.applyDefaults()
+	thumbnailCacheLock.Lock()
+	defer thumbnailCacheLock.Unlock()
+	for _, location := range locations {
+		thumbnailCache[fmt.Sprintf("%d_%d_%dx%d", location.X, location.Y, webhook.MapWidth, webhook.MapHeight)] = []byte("png")
+	}
+	return webhook
+}
+
+// testLocationStars returns count stars on different worlds at the location.
+func testLocationStars(location *StarLocation, count int) []*Star {
+	now := time.Now().Unix()
+	var stars []*Star
+	for index := 0; index < count; index++ {
+		stars = append(stars, &Star{
+			CalledLocation: location.Name,
+			MappedLocation: location,
+			Tier:           1 + index%9,
+			World:          300 + index,
+			DepleteTime:    now + 600,
+		})
+	}
+	return stars
+}
+
+func TestCreateEmbedListingMessagesSplitsLocations(t *testing.T) {
+	location := &StarLocation{Name: "Aldarin", Region: "Varlamore", X: 1000, Y: 2000}
+	stars := testLocationStars(location, 20)
+
+	messages, err := createEmbedListingMessages(&stars, testWebhook(FormatEmbed, location))
+	if err != nil {
+		t.Fatalf("createEmbedListingMessages failed: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected a single page, got %d", len(messages))
+	}
+
+	embeds := *messages[0].Embeds
+	if len(embeds) != 3 {
+		t.Fatalf("expected the location to be split into 3 embeds, got %d", len(embeds))
+	}
+	worlds := make(map[string]bool)
+	for index, embed := range embeds {
+		if len(*embed.Fields) > maxEmbedFields {
+			t.Errorf("embed %d has %d fields", index, len(*embed.Fields))
+		}
+		if (embed.Image != nil) != (index == 0) {
+			t.Errorf("embed %d has image %v, only the first embed shows the map", index, embed.Image)
+		}
+		for _, field := range *embed.Fields {
+			if field.Name == "World" {
+				worlds[field.Value] = true
+			}
+		}
+	}
+	for _, star := range stars {
+		if !worlds[strconv.Itoa(star.World)] {
+			t.Errorf("star on world %d is missing from the listing", star.World)
+		}
+	}
+	if len(*messages[0].Files) != 1 {
+		t.Errorf("expected one thumbnail, got %d", len(*messages[0].Files))
+	}
+}
+
+func TestCreateEmbedListingMessagesPaginatesOnLength(t *testing.T) {
+	var locations []*StarLocation
+	var stars []*Star
+	for index := 0; index < maxEmbeds; index++ {
+		location := &StarLocation{
+			Name:   fmt.Sprintf("%s %d", strings.Repeat("Location", 30), index),
+			Region: strings.Repeat("Region", 80),
+			X:      1000 + index,
+			Y:      2000,
+		}
+		locations = append(locations, location)
+		stars = append(stars, testLocationStars(location, maxEmbedStars)...)
+	}
+
+	messages, err := createEmbedListingMessages(&stars, testWebhook(FormatEmbed, locations...))
+	if err != nil {
+		t.Fatalf("createEmbedListingMessages failed: %v", err)
+	}
+	if len(messages) < 2 {
+		t.Fatalf("expected the embeds to be split across pages, got %d page(s)", len(messages))
+	}
+	embeds := 0
+	for index, message := range messages {
+		length := 0
+		for _, embed := range *message.Embeds {
+			length += embedLength(embed)
+		}
+		if length > maxEmbedsLength || len(*message.Embeds) > maxEmbeds {
+			t.Errorf("page %d has %d embeds of %d characters", index, len(*message.Embeds), length)
+		}
+		if len(*message.Files) != len(*message.Embeds) {
+			t.Errorf("page %d has %d thumbnails for %d embeds", index, len(*message.Files), len(*message.Embeds))
+		}
+		embeds += len(*message.Embeds)
+	}
+	if embeds != len(locations) {
+		t.Errorf("expected %d embeds across the pages, got %d", len(locations), embeds)
+	}
+}
+
+func TestDiscordListingRepostedWhenThreadChanges(t *testing.T) {
+	server := newFakeDiscordServer(t)
+	location := &StarLocation{Name: "Aldarin", X: 1000, Y: 2000}
+	stars := testLocationStars(location, 1)
+	webhook := testWebhook(FormatDefault, location)
+	webhook.Url = server.URL + "/api/webhooks/1/token"
+	webhook.ThreadId = "111"
+	database := newTestDatabase(t)
+	notifier := NewDiscordNotifier([]*Webhook{webhook}, database)
+
+	_ = notifier.UpdateListing(&stars)
+	if requests := server.take(); !slices.Equal(requests, []discordRequest{
+		{http.MethodPost, "/api/webhooks/1/token", "111"},
+	}) {
+		t.Fatalf("unexpected requests for posting the listing: %+v", requests)
+	}
+
+	_ = notifier.UpdateListing(&stars)
+	if requests := server.take(); !slices.Equal(requests, []discordRequest{
+		{http.MethodPatch, "/api/webhooks/1/token/messages/1", "111"},
+	}) {
+		t.Fatalf("unexpected requests for editing the listing: %+v", requests)
+	}
+
+	webhook.ThreadId = "222"
+	_ = notifier.UpdateListing(&stars)
+	if requests := server.take(); !slices.Equal(requests, []discordRequest{
+		{http.MethodDelete, "/api/webhooks/1/token/messages/1", "111"},
+		{http.MethodPost, "/api/webhooks/1/token", "222"},
+	}) {
+		t.Fatalf("unexpected requests after changing the thread: %+v", requests)
+	}
+	if threadId, _ := database.GetListingThread(webhook.Url); threadId != "222" {
+		t.Errorf("listing thread was not stored: %q", threadId)
+	}
+	if messageIds := database.GetListingMessages(webhook.Url); !slices.Equal(messageIds, []string{"2"}) {
+		t.Errorf("unexpected listing messages %v", messageIds)
+	}
+}
+
+func TestCreateNewStarMessageFooter(t *testing.T) {
+	location := &StarLocation{Name: "Aldarin", X: 1000, Y: 2000}
+	for _, temporary := range []bool{false, true} {
+		stars := testLocationStars(location, 1)
+		message, err := createNewStarMessage(&stars, nil, testWebhook(FormatDefault), temporary)
+		if err != nil {
+			t.Fatalf("createNewStarMessage failed: %v", err)
+		}
+		if footer := strings.Contains(message.Content, "temporary message"); footer != temporary {
+			t.Errorf("temporary %v message has footer %v: %q", temporary, footer, message.Content)
+		}
+	}
+}
+
+func TestDiscordPostListingDeletesOldPages(t *testing.T) {
+	server := newFakeDiscordServer(t)
+	location := &StarLocation{Name: "Aldarin", X: 1000, Y: 2000}
+	stars := testLocationStars(location, 1)
+	webhook := testWebhook(FormatDefault, location)
+	webhook.Url = server.URL + "/api/webhooks/1/token"
+	database := newTestDatabase(t)
+	notifier := NewDiscordNotifier([]*Webhook{webhook}, database)
+
+	_ = notifier.PostListing(&stars)
+	server.take()
+	_ = notifier.PostListing(&stars)
+	requests := server.take()
+	if !slices.Equal(requests, []discordRequest{
+		{http.MethodDelete, "/api/webhooks/1/token/messages/1", ""},
+		{http.MethodPost, "/api/webhooks/1/token", ""},
+	}) {
+		t.Fatalf("unexpected requests for reposting the listing: %+v", requests)
+	}
+	if messageIds := database.GetListingMessages(webhook.Url); !slices.Equal(messageIds, []string{"2"}) {
+		t.Errorf("unexpected listing messages %v", messageIds)
+	}
+	if entries := database.GetOutboxEntries(webhook.Url); len(entries) != 0 {
+		t.Errorf("outbox entries left behind: %+v", entries)
+	}
+}
+
+func TestCreateTextListingMessagesSplitsPages(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		locations int
+		stars     int
+		pages     int
+	}{
+		{"a single page", 1, 10, 1},
+		{"content length", 1, 80, 3},
+		{"attachments", 12, 1, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var locations []*StarLocation
+			var stars []*Star
+			for index := 0; index < test.locations; index++ {
+				location := &StarLocation{Name: fmt.Sprintf("Location %d", index), X: 1000 + index, Y: 2000}
+				locations = append(locations, location)
+				for _, star := range testLocationStars(location, test.stars) {
+					star.World += index * test.stars
+					stars = append(stars, star)
+				}
+			}
+			webhook := testWebhook(FormatDefault, locations...)
+			footer := "Updated every minute"
+			webhook.ListingFooter = &footer
+
+			messages, err := createTextListingMessages(&stars, webhook)
+			if err != nil {
+				t.Fatalf("createTextListingMessages failed: %v", err)
+			}
+			if len(messages) != test.pages {
+				t.Fatalf("expected %d page(s), got %d", test.pages, len(messages))
+			}
+			content := ""
+			for index, message := range messages {
+				if len(message.Content) > maxContentLength || len(*message.Files) > maxAttachments {
+					t.Errorf("page %d has %d characters and %d attachments", index, len(message.Content), len(*message.Files))
+				}
+				if hasFooter := strings.HasSuffix(message.Content, footer); hasFooter != (index == len(messages)-1) {
+					t.Errorf("page %d has footer %v", index, hasFooter)
+				}
+				content += message.Content
+			}
+			for _, star := range stars {
+				if !strings.Contains(content, fmt.Sprintf("[World %d,", star.World)) {
+					t.Errorf("star on world %d is missing from the listing", star.World)
+				}
+			}
+		})
+	}
+}
+
+func TestSortedStarsKeepsSharedList(t *testing.T) {
+	stars := []*Star{{World: 301, DepleteTime: 100}, {World: 302, DepleteTime: 300}, {World: 303, DepleteTime: 200}}
+	shared := slices.Clone(stars)
+
+	sorted := sortedStars(&shared)
+	if !slices.Equal(shared, stars) {
+		t.Errorf("the shared list was reordered")
+	}
+	var worlds []int
+	for _, star := range *sorted {
+		worlds = append(worlds, star.World)
+	}
+	if !slices.Equal(worlds, []int{302, 303, 301}) {
+		t.Errorf("unexpected order %v", worlds)
+	}
+}
+
+func TestSortedStarsByProximity(t *testing.T) {
+	sortByProximity, homePoints := SortByProximity, HomePoints
+	SortByProximity, HomePoints = true, []*HomePoint{{Name: "Bank", X: 0, Y: 0}}
+	t.Cleanup(func() {
+		SortByProximity, HomePoints = sortByProximity, homePoints
+	})
+
+	near := &StarLocation{Name: "Near", X: 10, Y: 0}
+	far := &StarLocation{Name: "Far", X: 100, Y: 0}
+	stars := []*Star{
+		{MappedLocation: far, World: 301, Tier: 9, DepleteTime: 900},
+		{MappedLocation: near, World: 302, Tier: 5, DepleteTime: 500},
+		{MappedLocation: near, World: 303, Tier: 7, DepleteTime: 500},
+		{MappedLocation: near, World: 304, Tier: 2, DepleteTime: 800},
+		{World: 305, Tier: 9, DepleteTime: 1000},
+		{MappedLocation: near, World: 306, Tier: 7, DepleteTime: 500},
+	}
+	// stars at the same distance are ordered by depletion, tier and world
+	expected := []int{304, 303, 306, 302, 301, 305}
+
+	for range 10 {
+		shuffled := slices.Clone(stars)
+		rand.Shuffle(len(shuffled), func(a, b int) {
+			shuffled[a], shuffled[b] = shuffled[b], shuffled[a]
+		})
+		var worlds []int
+		for _, star := range *sortedStars(&shuffled) {
+			worlds = append(worlds, star.World)
+		}
+		if !slices.Equal(worlds, expected) {
+			t.Fatalf("unexpected order %v, expected %v", worlds, expected)
+		}
+	}
+}
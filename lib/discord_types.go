@@ -3,7 +3,11 @@ package lib
 type DiscordMessage struct {
 	Files       *[]DiscordFile       `json:"-"`
 	Content     string               `json:"content,omitempty"`
+	ThreadName  string               `json:"thread_name,omitempty"`
+	Username    string               `json:"username,omitempty"`
+	AvatarUrl   string               `json:"avatar_url,omitempty"`
 	Embeds      *[]DiscordEmbed      `json:"embeds,omitempty"`
+	Components  *[]DiscordComponent  `json:"components,omitempty"`
 	Attachments *[]DiscordAttachment `json:"attachments"`
 }
 
@@ -22,6 +26,7 @@ type DiscordAttachment struct {
 type DiscordEmbed struct {
 	Title       string               `json:"title,omitempty"`
 	Description string               `json:"description,omitempty"`
+	Color       int                  `json:"color,omitempty"`
 	Image       *DiscordEmbedImage   `json:"image,omitempty"`
 	Fields      *[]DiscordEmbedField `json:"fields,omitempty"`
 }
@@ -35,3 +40,17 @@ type DiscordEmbedField struct {
 	Value  string `json:"value"`
 	Inline bool   `json:"inline,omitempty"`
 }
+
+const (
+	ComponentTypeActionRow = 1
+	ComponentTypeButton    = 2
+	ButtonStyleLink        = 5
+)
+
+type DiscordComponent struct {
+	Type       int                 `json:"type"`
+	Style      int                 `json:"style,omitempty"`
+	Label      string              `json:"label,omitempty"`
+	Url        string              `json:"url,omitempty"`
+	Components *[]DiscordComponent `json:"components,omitempty"`
+}
@@ -0,0 +1,302 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"star-notifier/lib/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type EmailRecipient struct {
+	Address string     `json:"address"`
+	Filters StarFilter `json:"filters"`
+}
+
+type SmtpConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	StartTls bool
+}
+
+// EmailNotifier buffers new stars matching each recipient's filters and sends
+// them as a multipart HTML and text digest with inline map thumbnails.
+type EmailNotifier struct {
+	smtp           SmtpConfig
+	recipients     []*EmailRecipient
+	digestInterval int
+	database       *db.Database
+}
+
+func NewEmailNotifier(smtp SmtpConfig, recipients []*EmailRecipient, digestInterval int, database *db.Database) *EmailNotifier {
+	return &EmailNotifier{
+		smtp:           smtp,
+		recipients:     recipients,
+		digestInterval: digestInterval,
+		database:       database,
+	}
+}
+
+// LoadEmailRecipients reads recipients from EMAIL_RECIPIENTS_FILE, or creates
+// them from the EMAIL_RECIPIENTS list with EMAIL_MIN_TIER as the filter.
+func LoadEmailRecipients() ([]*EmailRecipient, error) {
+	if len(EmailRecipientsFile) == 0 {
+		var recipients []*EmailRecipient
+		for _, address := range EmailRecipients {
+			recipients = append(recipients, &EmailRecipient{
+				Address: strings.TrimSpace(address),
+				Filters: StarFilter{MinTier: EmailMinTier},
+			})
+		}
+		return recipients, nil
+	}
+
+	content, err := os.ReadFile(EmailRecipientsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read email recipients file: %w", err)
+	}
+	var recipients []*EmailRecipient
+	if err = json.Unmarshal(content, &recipients); err != nil {
+		return nil, fmt.Errorf("failed to parse email recipients file: %w", err)
+	}
+	return recipients, nil
+}
+
+func (notifier *EmailNotifier) Name() string {
+	return "email"
+}
+
+func (notifier *EmailNotifier) PostListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *EmailNotifier) UpdateListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *EmailNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	for _, recipient := range notifier.recipients {
+		for _, star := range *recipient.Filters.Apply(stars) {
+			notifier.database.AddDigestStar(emailKey(recipient.Address), ToStarRecord(star), timestamp)
+		}
+	}
+	notifier.database.SaveUnsafe()
+	return nil
+}
+
+func (notifier *EmailNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+func (notifier *EmailNotifier) Tick(timestamp int64) error {
+	var failed int
+	for _, recipient := range notifier.recipients {
+		key := emailKey(recipient.Address)
+		if timestamp-notifier.database.GetLastDigest(key) < int64(notifier.digestInterval*60) {
+			continue
+		}
+
+		var stars []*Star
+		for _, record := range notifier.database.GetDigestStars(key) {
+			if record.DepleteTime < timestamp {
+				continue
+			}
+			if star := FromStarRecord(record); star != nil {
+				stars = append(stars, star)
+			}
+		}
+		if len(stars) > 0 {
+			log.Printf("Emailing digest of %d star(s) to %s\n", len(stars), recipient.Address)
+			if err := notifier.send(recipient.Address, &stars, timestamp); err != nil {
+				log.Println("Failed to email digest to", recipient.Address, err)
+				failed++
+				continue
+			}
+		}
+		notifier.database.ClearDigest(key, timestamp)
+		notifier.database.SaveUnsafe()
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to email %d digest(s)", failed)
+	}
+	return nil
+}
+
+func (notifier *EmailNotifier) send(recipient string, stars *[]*Star, timestamp int64) error {
+	message, err := createEmailMessage(notifier.smtp.From, recipient, stars, timestamp)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(notifier.smtp.Host, strconv.Itoa(notifier.smtp.Port))
+	client, err := smtp.Dial(address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer func(client *smtp.Client) {
+		_ = client.Close()
+	}(client)
+
+	if notifier.smtp.StartTls {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server does not support STARTTLS")
+		}
+		if err = client.StartTLS(&tls.Config{ServerName: notifier.smtp.Host}); err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	if len(notifier.smtp.Username) > 0 {
+		auth := smtp.PlainAuth("", notifier.smtp.Username, notifier.smtp.Password, notifier.smtp.Host)
+		if err = client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+	if err = client.Mail(notifier.smtp.From); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	if err = client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message data: %w", err)
+	}
+	if _, err = writer.Write(message); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err = writer.Close(); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return client.Quit()
+}
+
+func emailKey(address string) string {
+	return "email:" + address
+}
+
+// createEmailMessage builds a multipart/related message holding the text and
+// html alternatives, followed by the map thumbnails referenced from the html
+// by content id.
+func createEmailMessage(from, to string, stars *[]*Star, timestamp int64) ([]byte, error) {
+	stars = sortedStars(stars)
+
+	var titles, textLines, htmlLines []string
+	var starLocations []*StarLocation
+	for _, star := range *stars {
+		titles = append(titles, formatStarTitle(star))
+		textLines = append(textLines, formatPlainStarLine(star, timestamp))
+
+		htmlLine := "<p>" + html.EscapeString(formatPlainStarLine(star, timestamp))
+		if star.MappedLocation != nil {
+			htmlLine += fmt.Sprintf(
+				`<br><img src="cid:%s" alt="%s" width="%d" height="%d">`,
+				thumbnailContentId(star.MappedLocation), html.EscapeString(star.MappedLocation.Name), MapWidth, MapHeight,
+			)
+			if !containsLocation(starLocations, star.MappedLocation) {
+				starLocations = append(starLocations, star.MappedLocation)
+			}
+		}
+		htmlLines = append(htmlLines, htmlLine+"</p>")
+	}
+
+	subject := truncate(fmt.Sprintf("%d new star(s): %s", len(*stars), strings.Join(titles, ", ")), 150)
+
+	body := new(bytes.Buffer)
+	related := multipart.NewWriter(body)
+
+	headers := new(bytes.Buffer)
+	fmt.Fprintf(headers, "From: %s\r\n", from)
+	fmt.Fprintf(headers, "To: %s\r\n", to)
+	fmt.Fprintf(headers, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(headers, "Date: %s\r\n", time.Unix(timestamp, 0).UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(headers, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(headers, "Content-Type: multipart/related; type=\"multipart/alternative\"; boundary=%s\r\n\r\n", related.Boundary())
+
+	alternativeBody := new(bytes.Buffer)
+	alternative := multipart.NewWriter(alternativeBody)
+	err := writeEmailPart(alternative, textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	}, []byte(strings.Join(textLines, "\r\n")))
+	if err != nil {
+		return nil, err
+	}
+	err = writeEmailPart(alternative, textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	}, []byte("<html><body>"+strings.Join(htmlLines, "\n")+"</body></html>"))
+	if err != nil {
+		return nil, err
+	}
+	if err = alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	part, err := related.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = part.Write(alternativeBody.Bytes()); err != nil {
+		return nil, err
+	}
+
+	for _, location := range starLocations {
+		thumbnail, err := GetThumbnail(location.X, location.Y, MapWidth, MapHeight)
+		if err != nil {
+			log.Println("Failed to create email thumbnail:", err)
+			continue
+		}
+		err = writeEmailPart(related, textproto.MIMEHeader{
+			"Content-Type":              {"image/png"},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Id":                {"<" + thumbnailContentId(location) + ">"},
+			"Content-Disposition":       {fmt.Sprintf("inline; filename=\"map%d_%d.png\"", location.X, location.Y)},
+		}, thumbnail)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err = related.Close(); err != nil {
+		return nil, err
+	}
+
+	return append(headers.Bytes(), body.Bytes()...), nil
+}
+
+func writeEmailPart(writer *multipart.Writer, header textproto.MIMEHeader, content []byte) error {
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(content)
+	// base64 lines are limited to 76 characters
+	for len(encoded) > 76 {
+		if _, err = part.Write([]byte(encoded[:76] + "\r\n")); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = part.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+func thumbnailContentId(location *StarLocation) string {
+	return fmt.Sprintf("map%d_%d@star-notifier", location.X, location.Y)
+}
@@ -0,0 +1,164 @@
+package lib
+
+import (
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// fakeSmtpServer accepts a single SMTP session and returns the message data
+// sent in it.
+func fakeSmtpServer(t *testing.T) (string, int, <-chan string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func(conn net.Conn) {
+			_ = conn.Close()
+		}(conn)
+
+		text := textproto.NewConn(conn)
+		_ = text.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			command, _, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(command) {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				_ = text.PrintfLine("250 OK")
+			case "DATA":
+				_ = text.PrintfLine("354 Go ahead")
+				message, err := io.ReadAll(text.DotReader())
+				if err != nil {
+					return
+				}
+				data <- string(message)
+				_ = text.PrintfLine("250 OK")
+			case "QUIT":
+				_ = text.PrintfLine("221 Bye")
+				return
+			default:
+				_ = text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port, data
+}
+
+func TestEmailNotifierSend(t *testing.T) {
+	host, port, data := fakeSmtpServer(t)
+	notifier := NewEmailNotifier(SmtpConfig{Host: host, Port: port, From: "stars@example.org"}, nil, 60, newTestDatabase(t))
+
+	timestamp := time.Now().Unix()
+	if err := notifier.send("player@example.org", testStars(), timestamp); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	var message *mail.Message
+	select {
+	case content := <-data:
+		var err error
+		if message, err = mail.ReadMessage(strings.NewReader(content)); err != nil {
+			t.Fatalf("failed to parse message: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("smtp server did not receive a message")
+	}
+
+	if message.Header.Get("From") != "stars@example.org" || message.Header.Get("To") != "player@example.org" {
+		t.Errorf("unexpected addresses: %v", message.Header)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil || subject != "1 new star(s): T8 star w330 Aldarin" {
+		t.Errorf("unexpected subject %q: %v", subject, err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/related" || params["type"] != "multipart/alternative" {
+		t.Fatalf("unexpected content type %q: %v", message.Header.Get("Content-Type"), err)
+	}
+	related := multipart.NewReader(message.Body, params["boundary"])
+	part, err := related.NextPart()
+	if err != nil {
+		t.Fatalf("failed to read related part: %v", err)
+	}
+	mediaType, params, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("first related part is not multipart/alternative: %q", part.Header.Get("Content-Type"))
+	}
+
+	alternative := multipart.NewReader(part, params["boundary"])
+	for _, expected := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", "[World 330, tier 8] Aldarin"},
+		{"text/html; charset=utf-8", "<html><body><p>[World 330, tier 8] Aldarin"},
+	} {
+		part, err := alternative.NextPart()
+		if err != nil {
+			t.Fatalf("missing %s part: %v", expected.contentType, err)
+		}
+		if part.Header.Get("Content-Type") != expected.contentType || part.Header.Get("Content-Transfer-Encoding") != "base64" {
+			t.Errorf("unexpected part headers: %v", part.Header)
+		}
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatalf("failed to decode %s part: %v", expected.contentType, err)
+		}
+		if !strings.HasPrefix(string(content), expected.content) {
+			t.Errorf("unexpected %s content %q", expected.contentType, content)
+		}
+	}
+	if _, err = alternative.NextPart(); err != io.EOF {
+		t.Errorf("expected only text and html alternatives: %v", err)
+	}
+	// stars without a mapped location have no thumbnails
+	if _, err = related.NextPart(); err != io.EOF {
+		t.Errorf("expected no thumbnail parts: %v", err)
+	}
+}
+
+func TestCreateEmailMessageTruncatesSubject(t *testing.T) {
+	var stars []*Star
+	for world := 300; world < 320; world++ {
+		stars = append(stars, &Star{CalledLocation: "Läkeside ✦", Tier: 8, World: world})
+	}
+	content, err := createEmailMessage("stars@example.org", "player@example.org", &stars, time.Now().Unix())
+	if err != nil {
+		t.Fatalf("createEmailMessage failed: %v", err)
+	}
+	message, err := mail.ReadMessage(strings.NewReader(string(content)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	if !utf8.ValidString(subject) || utf8.RuneCountInString(subject) != 150 || !strings.HasSuffix(subject, "...") {
+		t.Errorf("subject was not truncated to 150 characters: %q", subject)
+	}
+}
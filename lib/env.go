@@ -2,6 +2,7 @@ package lib
 
 import (
 	"os"
+	"strings"
 )
 
 var (
@@ -11,12 +12,61 @@ var (
 	ApiUserAgent          = os.Getenv("STARS_API_USER_AGENT")
 	ApiReferer            = os.Getenv("STARS_API_REFERER")
 	AllowedLocations      = GetEnvList("ALLOWED_LOCATIONS", ",")
+	LocationsFile         = os.Getenv("LOCATIONS_FILE")
 	SleepTime             = GetEnvInt("SLEEP_TIME_SECONDS", 30)
 	ListingUpdateInterval = GetEnvInt("LISTING_UPDATE_INTERVAL", 1)
 	MapWidth              = GetEnvInt("MAP_WIDTH", 512)
 	MapHeight             = GetEnvInt("MAP_HEIGHT", 512)
 	WebhookUrls           = GetEnvList("DISCORD_WEBHOOK_URLS", ",")
+	WebhookConfigFile     = os.Getenv("WEBHOOK_CONFIG_FILE")
 	ListingFooter         = GetEnv("LISTING_FOOTER", "")
 	NewStarMessageMaxAge  = GetEnvInt("NEW_STAR_MESSAGE_MAX_AGE", 50)
+	DigestInterval        = GetEnvInt("DIGEST_INTERVAL", 15)
 	ExcludedWorlds        = GetEnvList("EXCLUDED_WORLDS", ",")
+	FreeWorlds            = parseWorlds(strings.Split(GetEnv("FREE_WORLDS", defaultFreeWorlds), ","))
+	DiscordMaxRetries     = GetEnvInt("DISCORD_MAX_RETRIES", 5)
+	DeliveryConcurrency   = GetEnvInt("DELIVERY_CONCURRENCY", 4)
+	DeliveryTimeout       = GetEnvInt("DELIVERY_TIMEOUT_SECONDS", 60)
+	OutboxMaxAge          = GetEnvInt("OUTBOX_MAX_AGE", 3600)
+	SlackApiUrl           = GetEnv("SLACK_API_URL", "https://slack.com/api")
+	SlackBotToken         = os.Getenv("SLACK_BOT_TOKEN")
+	SlackWebhookUrls      = GetEnvList("SLACK_WEBHOOK_URLS", ",")
+	SlackChannels         = GetEnvList("SLACK_CHANNELS", ",")
+	TelegramApiUrl        = GetEnv("TELEGRAM_API_URL", "https://api.telegram.org")
+	TelegramBotToken      = os.Getenv("TELEGRAM_BOT_TOKEN")
+	TelegramChatIds       = GetEnvList("TELEGRAM_CHAT_IDS", ",")
+	JsonWebhookUrls       = GetEnvList("JSON_WEBHOOK_URLS", ",")
+	JsonWebhookSecret     = os.Getenv("JSON_WEBHOOK_SECRET")
+	JsonWebhookRetries    = GetEnvInt("JSON_WEBHOOK_RETRIES", 3)
+	MatrixHomeserverUrl   = os.Getenv("MATRIX_HOMESERVER_URL")
+	MatrixAccessToken     = os.Getenv("MATRIX_ACCESS_TOKEN")
+	MatrixRoomIds         = GetEnvList("MATRIX_ROOM_IDS", ",")
+	SmtpHost              = os.Getenv("SMTP_HOST")
+	SmtpPort              = GetEnvInt("SMTP_PORT", 587)
+	SmtpUsername          = os.Getenv("SMTP_USERNAME")
+	SmtpPassword          = os.Getenv("SMTP_PASSWORD")
+	SmtpFrom              = os.Getenv("SMTP_FROM")
+	SmtpStartTls          = GetEnvBool("SMTP_STARTTLS", true)
+	EmailRecipients       = GetEnvList("EMAIL_RECIPIENTS", ",")
+	EmailRecipientsFile   = os.Getenv("EMAIL_RECIPIENTS_FILE")
+	EmailMinTier          = GetEnvInt("EMAIL_MIN_TIER", 0)
+	EmailDigestInterval   = GetEnvInt("EMAIL_DIGEST_INTERVAL", 60)
+	NtfyTopicUrls         = GetEnvList("NTFY_TOPIC_URLS", ",")
+	NtfyToken             = os.Getenv("NTFY_TOKEN")
+	GotifyUrl             = os.Getenv("GOTIFY_URL")
+	GotifyToken           = os.Getenv("GOTIFY_TOKEN")
+	PushMinTier           = GetEnvInt("PUSH_MIN_TIER", 0)
+	MapUrlTemplate        = GetEnv("MAP_URL", "https://mejrs.github.io/osrs?m=-1&z=3&p=0&x={x}&y={y}")
+	WikiUrl               = GetEnv("WIKI_URL", "https://oldschool.runescape.wiki/w/Shooting_Stars")
+	WorldUrlTemplate      = GetEnv("WORLD_URL", "https://oldschool.runescape.com/slu?world={world}")
+	MqttBrokerUrl         = os.Getenv("MQTT_BROKER_URL")
+	MqttTopicPrefix       = GetEnv("MQTT_TOPIC_PREFIX", "stars")
+	MqttClientId          = GetEnv("MQTT_CLIENT_ID", defaultMqttClientId())
+	MqttUsername          = os.Getenv("MQTT_USERNAME")
+	MqttPassword          = os.Getenv("MQTT_PASSWORD")
+	HttpListenAddress     = os.Getenv("HTTP_LISTEN_ADDRESS")
+	FeedBaseUrl           = os.Getenv("FEED_BASE_URL")
+	FeedSize              = GetEnvInt("FEED_SIZE", 50)
+	HomePointList         = GetEnvList("HOME_POINTS", ",")
+	SortByProximity       = GetEnvBool("SORT_BY_PROXIMITY", false)
 )
@@ -0,0 +1,161 @@
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+)
+
+const EventVersion = 1
+
+const (
+	EventNewStar         = "star.new"
+	EventTierUpdate      = "star.tier_update"
+	EventDepleted        = "star.depleted"
+	EventListingSnapshot = "listing.snapshot"
+)
+
+// StarChanges describes how the star list changed between two checks.
+type StarChanges struct {
+	New      []*Star
+	Updated  []*Star
+	Depleted []*Star
+}
+
+// ChangeNotifier is implemented by notifiers that deliver tier updates and
+// depletions in addition to new star announcements.
+type ChangeNotifier interface {
+	NotifyChanges(changes *StarChanges, timestamp int64) error
+}
+
+// StarEvent is the versioned envelope of events published to generic
+// consumers.
+type StarEvent struct {
+	Version   int            `json:"version"`
+	Id        string         `json:"id"`
+	Type      string         `json:"type"`
+	Timestamp int64          `json:"timestamp"`
+	Star      *StarPayload   `json:"star,omitempty"`
+	Stars     []*StarPayload `json:"stars,omitempty"`
+}
+
+// StarPayload is the platform independent representation of a star used in
+// published events.
+type StarPayload struct {
+	Id             string `json:"id"`
+	World          int    `json:"world"`
+	Tier           int    `json:"tier"`
+	Location       int    `json:"location"`
+	CalledLocation string `json:"calledLocation"`
+	Region         string `json:"region,omitempty"`
+	X              int    `json:"x"`
+	Y              int    `json:"y"`
+	CalledAt       int64  `json:"calledAt"`
+	MinTime        int64  `json:"minTime"`
+	MaxTime        int64  `json:"maxTime"`
+	DepleteTime    int64  `json:"depleteTime"`
+}
+
+func (star *Star) Key() string {
+	return fmt.Sprintf("%d|%d|%s", star.World, star.Location, star.CalledLocation)
+}
+
+func (star *Star) Payload() *StarPayload {
+	payload := &StarPayload{
+		Id:             fmt.Sprintf("%d-%d-%d", star.World, star.Location, star.CalledAt),
+		World:          star.World,
+		Tier:           star.Tier,
+		Location:       star.Location,
+		CalledLocation: star.CalledLocation,
+		Region:         GetRegionName(star.Location, star.MappedLocation),
+		CalledAt:       star.CalledAt,
+		MinTime:        star.MinTime,
+		MaxTime:        star.MaxTime,
+		DepleteTime:    star.DepleteTime,
+	}
+	if star.MappedLocation != nil {
+		payload.X = star.MappedLocation.X
+		payload.Y = star.MappedLocation.Y
+	}
+	return payload
+}
+
+func StarPayloads(stars *[]*Star) []*StarPayload {
+	payloads := make([]*StarPayload, 0)
+	if stars == nil {
+		return payloads
+	}
+	for _, star := range *stars {
+		payloads = append(payloads, star.Payload())
+	}
+	return payloads
+}
+
+// NewStarEvent creates an event about a single star. The event id only
+// depends on the event type and the star, so it can be used as an
+// idempotency key.
+func NewStarEvent(eventType string, star *Star, timestamp int64) *StarEvent {
+	payload := star.Payload()
+	return &StarEvent{
+		Version:   EventVersion,
+		Id:        eventId(eventType, payload.Id, strconv.Itoa(star.Tier)),
+		Type:      eventType,
+		Timestamp: timestamp,
+		Star:      payload,
+	}
+}
+
+func NewSnapshotEvent(stars *[]*Star, timestamp int64) *StarEvent {
+	return &StarEvent{
+		Version:   EventVersion,
+		Id:        eventId(EventListingSnapshot, strconv.FormatInt(timestamp, 10)),
+		Type:      EventListingSnapshot,
+		Timestamp: timestamp,
+		Stars:     StarPayloads(stars),
+	}
+}
+
+func eventId(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// DiffStars compares two star lists. Nothing is reported without a previous
+// list to compare against.
+func DiffStars(previous, current *[]*Star) *StarChanges {
+	changes := &StarChanges{}
+	if previous == nil || current == nil {
+		return changes
+	}
+
+	previousStars := make(map[string]*Star)
+	for _, star := range *previous {
+		previousStars[star.Key()] = star
+	}
+	currentStars := make(map[string]*Star)
+	for _, star := range *current {
+		currentStars[star.Key()] = star
+
+		previousStar, ok := previousStars[star.Key()]
+		if !ok {
+			changes.New = append(changes.New, star)
+		} else if previousStar.Tier != star.Tier {
+			changes.Updated = append(changes.Updated, star)
+		}
+	}
+	for _, star := range *previous {
+		if _, ok := currentStars[star.Key()]; !ok {
+			changes.Depleted = append(changes.Depleted, star)
+		}
+	}
+	return changes
+}
+
+func (changes *StarChanges) IsEmpty() bool {
+	return len(changes.New) == 0 && len(changes.Updated) == 0 && len(changes.Depleted) == 0
+}
@@ -0,0 +1,181 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"star-notifier/lib/db"
+	"strings"
+	"sync"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Summary string      `xml:"summary"`
+	Author  *atomAuthor `xml:"author,omitempty"`
+	Links   []atomLink  `xml:"link"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// FeedNotifier records new stars in the database and serves the most recent
+// ones as an Atom feed.
+type FeedNotifier struct {
+	database *db.Database
+	size     int
+	baseUrl  string
+
+	lock        sync.RWMutex
+	recentStars []db.RecentStar
+}
+
+func NewFeedNotifier(database *db.Database, size int, baseUrl string) *FeedNotifier {
+	return &FeedNotifier{
+		database:    database,
+		size:        size,
+		baseUrl:     strings.TrimSuffix(baseUrl, "/"),
+		recentStars: database.GetRecentStars(),
+	}
+}
+
+func (notifier *FeedNotifier) Name() string {
+	return "feed"
+}
+
+func (notifier *FeedNotifier) PostListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *FeedNotifier) UpdateListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *FeedNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	for _, star := range *stars {
+		notifier.database.AddRecentStar(ToStarRecord(star), timestamp, notifier.size)
+	}
+	notifier.database.SaveUnsafe()
+
+	notifier.lock.Lock()
+	notifier.recentStars = notifier.database.GetRecentStars()
+	notifier.lock.Unlock()
+	return nil
+}
+
+func (notifier *FeedNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+func (notifier *FeedNotifier) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	notifier.lock.RLock()
+	recentStars := slices.Clone(notifier.recentStars)
+	notifier.lock.RUnlock()
+
+	baseUrl := notifier.baseUrl
+	if len(baseUrl) == 0 {
+		baseUrl = requestBaseUrl(request)
+	}
+
+	feed := createAtomFeed(recentStars, baseUrl)
+	output, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		log.Println("Failed to encode atom feed:", err)
+		http.Error(writer, "failed to encode feed", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	_, _ = writer.Write([]byte(xml.Header))
+	_, _ = writer.Write(output)
+}
+
+func createAtomFeed(recentStars []db.RecentStar, baseUrl string) *atomFeed {
+	feed := &atomFeed{
+		Id:      "urn:star-notifier:feed",
+		Title:   "Shooting stars",
+		Updated: formatAtomTime(0),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: baseUrl + "/feed.atom"},
+		},
+	}
+
+	// newest first
+	for i := len(recentStars) - 1; i >= 0; i-- {
+		recentStar := recentStars[i]
+		star := FromStarRecord(recentStar.Star)
+		if star == nil {
+			continue
+		}
+		if len(feed.Entries) == 0 {
+			feed.Updated = formatAtomTime(recentStar.DetectedTimestamp)
+		}
+
+		entry := atomEntry{
+			Id:      "urn:star-notifier:star:" + star.Payload().Id,
+			Title:   formatStarTitle(star),
+			Updated: formatAtomTime(recentStar.DetectedTimestamp),
+			Summary: formatFeedSummary(star),
+			Author:  &atomAuthor{Name: "star-notifier"},
+			Links: []atomLink{
+				{Rel: "alternate", Type: "text/html", Href: MapUrl(star.MappedLocation)},
+			},
+		}
+		if star.MappedLocation != nil {
+			entry.Links = append(entry.Links, atomLink{
+				Rel:  "enclosure",
+				Type: "image/png",
+				Href: fmt.Sprintf("%s/map/%d_%d.png", baseUrl, star.MappedLocation.X, star.MappedLocation.Y),
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+func formatFeedSummary(star *Star) string {
+	return fmt.Sprintf(
+		"World %d, tier %d, %s. Called at %s, est. depletion at %s.%s",
+		star.World,
+		star.Tier,
+		star.CalledLocation,
+		time.Unix(star.CalledAt, 0).UTC().Format("15:04 UTC"),
+		time.Unix(star.DepleteTime, 0).UTC().Format("15:04 UTC"),
+		formatHomePointDistance(star),
+	)
+}
+
+func formatAtomTime(timestamp int64) string {
+	return time.Unix(timestamp, 0).UTC().Format(time.RFC3339)
+}
+
+func requestBaseUrl(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	if forwardedProto := request.Header.Get("X-Forwarded-Proto"); len(forwardedProto) > 0 {
+		scheme = forwardedProto
+	}
+	return scheme + "://" + request.Host
+}
@@ -0,0 +1,95 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// Running covers two tiles per 0.6 second game tick.
+const secondsPerTile = 0.3
+
+type HomePoint struct {
+	Name string
+	X    int
+	Y    int
+}
+
+type HomePointDistance struct {
+	HomePoint *HomePoint
+	Tiles     int
+}
+
+var HomePoints = parseHomePoints(HomePointList)
+
+// parseHomePoints reads entries in the form of "name:x:y".
+func parseHomePoints(entries []string) []*HomePoint {
+	var homePoints []*HomePoint
+	for _, entry := range entries {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 {
+			log.Println("Ignoring invalid home point", entry)
+			continue
+		}
+		x, errX := strconv.Atoi(strings.TrimSpace(parts[1]))
+		y, errY := strconv.Atoi(strings.TrimSpace(parts[2]))
+		if errX != nil || errY != nil {
+			log.Println("Ignoring home point with invalid coordinates", entry)
+			continue
+		}
+		homePoints = append(homePoints, &HomePoint{
+			Name: strings.TrimSpace(parts[0]),
+			X:    x,
+			Y:    y,
+		})
+	}
+	return homePoints
+}
+
+// TileDistance is the number of tiles walked between two points, diagonal
+// steps counting as one tile.
+func TileDistance(x1, y1, x2, y2 int) int {
+	return max(abs(x1-x2), abs(y1-y2))
+}
+
+func (star *Star) NearestHomePoint() *HomePointDistance {
+	if star.MappedLocation == nil {
+		return nil
+	}
+	var nearest *HomePointDistance
+	for _, homePoint := range HomePoints {
+		tiles := TileDistance(homePoint.X, homePoint.Y, star.MappedLocation.X, star.MappedLocation.Y)
+		if nearest == nil || tiles < nearest.Tiles {
+			nearest = &HomePointDistance{
+				HomePoint: homePoint,
+				Tiles:     tiles,
+			}
+		}
+	}
+	return nearest
+}
+
+func (distance *HomePointDistance) String() string {
+	seconds := int(float64(distance.Tiles) * secondsPerTile)
+	estimate := fmt.Sprintf("%ds", seconds)
+	if seconds >= 60 {
+		estimate = fmt.Sprintf("%dm %ds", seconds/60, seconds%60)
+	}
+	return fmt.Sprintf("%d tiles from %s, ~%s run", distance.Tiles, distance.HomePoint.Name, estimate)
+}
+
+func formatHomePointDistance(star *Star) string {
+	distance := star.NearestHomePoint()
+	if distance == nil {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", distance)
+}
+
+func abs(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
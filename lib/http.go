@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var notifierClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// sendJson sends the payload as json and decodes a json response body into
+// response when given. Non-2xx responses are returned as errors along with
+// their status code.
+func sendJson(method, url string, headers map[string]string, payload any, response any) (int, error) {
+	body := new(bytes.Buffer)
+	if payload != nil {
+		if err := json.NewEncoder(body).Encode(payload); err != nil {
+			return -1, fmt.Errorf("failed to encode payload: %w", err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return doRequest(req, response)
+}
+
+func doRequest(req *http.Request, response any) (int, error) {
+	resp, err := notifierClient.Do(req)
+	if err != nil {
+		return -1, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}(resp.Body)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(respBody))
+	}
+	if response != nil && len(respBody) > 0 {
+		if err = json.Unmarshal(respBody, response); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to parse response body: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
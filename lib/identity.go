@@ -0,0 +1,47 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+)
+
+// WebhookIdentity overrides the name and avatar of the webhook for a type of
+// message. New star identities apply to messages with a star of at least
+// MinTier, and {tier} in the username is replaced with the highest tier.
+type WebhookIdentity struct {
+	Username  string `json:"username,omitempty"`
+	AvatarUrl string `json:"avatarUrl,omitempty"`
+	MinTier   int    `json:"minTier,omitempty"`
+}
+
+// GetNewStarIdentity returns the new star identity with the highest MinTier
+// matching the stars, or nil if none matches.
+func (webhook *Webhook) GetNewStarIdentity(stars *[]*Star) *WebhookIdentity {
+	maxTier := highestTier(stars)
+	var identity *WebhookIdentity
+	for index := range webhook.NewStarIdentities {
+		candidate := &webhook.NewStarIdentities[index]
+		if candidate.MinTier <= maxTier && (identity == nil || candidate.MinTier > identity.MinTier) {
+			identity = candidate
+		}
+	}
+	return identity
+}
+
+func (identity *WebhookIdentity) apply(message *DiscordMessage, stars *[]*Star) {
+	if identity == nil {
+		return
+	}
+	username := strings.ReplaceAll(identity.Username, "{tier}", strconv.Itoa(highestTier(stars)))
+	// webhook usernames are limited to 80 characters
+	message.Username = truncate(username, 80)
+	message.AvatarUrl = identity.AvatarUrl
+}
+
+func highestTier(stars *[]*Star) int {
+	tier := 0
+	for _, star := range *stars {
+		tier = max(tier, star.Tier)
+	}
+	return tier
+}
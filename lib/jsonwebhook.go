@@ -0,0 +1,160 @@
+package lib
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// JsonWebhookNotifier POSTs versioned star events to generic webhooks. Each
+// request is signed with an HMAC-SHA256 of "<timestamp>.<body>" using the
+// shared secret, and carries an idempotency key that stays the same across
+// retries of the same event.
+type JsonWebhookNotifier struct {
+	urls    []string
+	secret  string
+	retries int
+
+	pending []*pendingJsonDelivery
+}
+
+// pendingJsonDelivery is a failed delivery of an event to a webhook, retried
+// on the following cycles.
+type pendingJsonDelivery struct {
+	url      string
+	event    *StarEvent
+	body     []byte
+	attempts int
+}
+
+func NewJsonWebhookNotifier(urls []string, secret string, retries int) *JsonWebhookNotifier {
+	return &JsonWebhookNotifier{
+		urls:    urls,
+		secret:  secret,
+		retries: retries,
+	}
+}
+
+func (notifier *JsonWebhookNotifier) Name() string {
+	return "json-webhook"
+}
+
+func (notifier *JsonWebhookNotifier) PostListing(stars *[]*Star) error {
+	return notifier.UpdateListing(stars)
+}
+
+func (notifier *JsonWebhookNotifier) UpdateListing(stars *[]*Star) error {
+	return notifier.send(NewSnapshotEvent(stars, time.Now().Unix()))
+}
+
+func (notifier *JsonWebhookNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	return notifier.sendStarEvents(EventNewStar, stars, timestamp)
+}
+
+func (notifier *JsonWebhookNotifier) NotifyChanges(changes *StarChanges, timestamp int64) error {
+	if err := notifier.sendStarEvents(EventTierUpdate, &changes.Updated, timestamp); err != nil {
+		return err
+	}
+	return notifier.sendStarEvents(EventDepleted, &changes.Depleted, timestamp)
+}
+
+func (notifier *JsonWebhookNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+// Tick retries the failed deliveries once per cycle, until they succeed, fail
+// with a client error or have been retried JSON_WEBHOOK_RETRIES times.
+func (notifier *JsonWebhookNotifier) Tick(timestamp int64) error {
+	pending := notifier.pending
+	notifier.pending = nil
+	for _, delivery := range pending {
+		delivery.attempts++
+		statusCode, err := notifier.post(delivery.url, delivery.event, delivery.body)
+		if err == nil {
+			continue
+		}
+		if !isRetryableStatus(statusCode) || delivery.attempts > notifier.retries {
+			log.Printf("Dropping %s event %s to %s after %d attempt(s): %v\n",
+				delivery.event.Type, delivery.event.Id, delivery.url, delivery.attempts, err)
+			continue
+		}
+		notifier.pending = append(notifier.pending, delivery)
+	}
+	return nil
+}
+
+func (notifier *JsonWebhookNotifier) sendStarEvents(eventType string, stars *[]*Star, timestamp int64) error {
+	var failed int
+	for _, star := range *stars {
+		if err := notifier.send(NewStarEvent(eventType, star, timestamp)); err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to deliver %d %s event(s)", failed, eventType)
+	}
+	return nil
+}
+
+func (notifier *JsonWebhookNotifier) send(event *StarEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", event.Type, err)
+	}
+
+	var failed int
+	for _, url := range notifier.urls {
+		statusCode, err := notifier.post(url, event, body)
+		if err == nil {
+			continue
+		}
+		log.Printf("Failed to deliver %s event %s to %s: %v\n", event.Type, event.Id, url, err)
+		failed++
+		// a newer snapshot is sent with the next listing update
+		if isRetryableStatus(statusCode) && notifier.retries > 0 && event.Type != EventListingSnapshot {
+			notifier.pending = append(notifier.pending, &pendingJsonDelivery{url: url, event: event, body: body, attempts: 1})
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to deliver %s event to %d webhook(s)", event.Type, failed)
+	}
+	return nil
+}
+
+// isRetryableStatus tells whether a failed delivery is retried, which it is
+// for network errors, 429 and 5xx responses but not for other client errors.
+func isRetryableStatus(statusCode int) bool {
+	return statusCode < 400 || statusCode >= 500 || statusCode == http.StatusTooManyRequests
+}
+
+func (notifier *JsonWebhookNotifier) post(url string, event *StarEvent, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return -1, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", event.Id)
+	req.Header.Set("X-Star-Event", event.Type)
+	req.Header.Set("X-Star-Timestamp", timestamp)
+	if len(notifier.secret) > 0 {
+		req.Header.Set("X-Star-Signature", "sha256="+signPayload(notifier.secret, timestamp, body))
+	}
+	return doRequest(req, nil)
+}
+
+func signPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
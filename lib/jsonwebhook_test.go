@@ -0,0 +1,111 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSignPayload(t *testing.T) {
+	signature := signPayload("secret", "1700000000", []byte(`{"type":"new_star"}`))
+	if signature != "4316671c6e759ee762055c098c159af825732c842f8dfc3e3db26278ba9b650c" {
+		t.Errorf("unexpected signature %s", signature)
+	}
+	if signPayload("other", "1700000000", []byte(`{"type":"new_star"}`)) == signature {
+		t.Error("signature does not depend on the secret")
+	}
+	if signPayload("secret", "1700000001", []byte(`{"type":"new_star"}`)) == signature {
+		t.Error("signature does not depend on the timestamp")
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	for _, test := range []struct {
+		statusCode int
+		retryable  bool
+	}{
+		{-1, true},
+		{http.StatusBadRequest, false},
+		{http.StatusUnauthorized, false},
+		{http.StatusNotFound, false},
+		{http.StatusTooManyRequests, true},
+		{http.StatusInternalServerError, true},
+		{http.StatusBadGateway, true},
+		{http.StatusServiceUnavailable, true},
+	} {
+		if retryable := isRetryableStatus(test.statusCode); retryable != test.retryable {
+			t.Errorf("status %d retryable %v, expected %v", test.statusCode, retryable, test.retryable)
+		}
+	}
+}
+
+type jsonWebhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+func TestJsonWebhookNotifierDelivery(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		statuses []int
+		retries  int
+		requests int
+	}{
+		{"delivered", []int{http.StatusOK}, 2, 1},
+		{"retried on later cycles", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, 2, 3},
+		{"retries exhausted", []int{http.StatusInternalServerError}, 2, 3},
+		{"client errors are not retried", []int{http.StatusBadRequest}, 2, 1},
+		{"retries disabled", []int{http.StatusInternalServerError}, 0, 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var lock sync.Mutex
+			var requests []jsonWebhookRequest
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				body, _ := io.ReadAll(request.Body)
+				lock.Lock()
+				requests = append(requests, jsonWebhookRequest{header: request.Header, body: body})
+				status := test.statuses[min(len(requests), len(test.statuses))-1]
+				lock.Unlock()
+				writer.WriteHeader(status)
+			}))
+			defer server.Close()
+			notifier := NewJsonWebhookNotifier([]string{server.URL}, "secret", test.retries)
+
+			_ = notifier.AnnounceNewStars(testStars(), time.Now().Unix())
+			for cycle := 0; cycle < 5; cycle++ {
+				_ = notifier.Tick(time.Now().Unix())
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			if len(requests) != test.requests {
+				t.Fatalf("expected %d request(s), got %d", test.requests, len(requests))
+			}
+			for _, request := range requests {
+				timestamp := request.header.Get("X-Star-Timestamp")
+				if request.header.Get("X-Star-Signature") != "sha256="+signPayload("secret", timestamp, request.body) {
+					t.Errorf("invalid signature %q", request.header.Get("X-Star-Signature"))
+				}
+				// retries are the same event
+				if request.header.Get("Idempotency-Key") != requests[0].header.Get("Idempotency-Key") ||
+					string(request.body) != string(requests[0].body) {
+					t.Errorf("retry differs from the first delivery: %v %s", request.header, request.body)
+				}
+				if request.header.Get("X-Star-Event") != EventNewStar || request.header.Get("Content-Type") != "application/json" {
+					t.Errorf("unexpected headers %v", request.header)
+				}
+			}
+			var event map[string]any
+			if err := json.Unmarshal(requests[0].body, &event); err != nil || event["type"] != EventNewStar {
+				t.Errorf("unexpected event %s: %v", requests[0].body, err)
+			}
+			if len(notifier.pending) != 0 {
+				t.Errorf("deliveries still pending: %d", len(notifier.pending))
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+)
+
+// MapUrl links to the location on a world map, filling {x} and {y} in the
+// MAP_URL template.
+func MapUrl(location *StarLocation) string {
+	if location == nil {
+		return WikiUrl
+	}
+	return strings.NewReplacer(
+		"{x}", strconv.Itoa(location.X),
+		"{y}", strconv.Itoa(location.Y),
+	).Replace(MapUrlTemplate)
+}
+
+// WorldUrl links to information about the world, filling {world} in the
+// WORLD_URL template.
+func WorldUrl(world int) string {
+	return strings.ReplaceAll(WorldUrlTemplate, "{world}", strconv.Itoa(world))
+}
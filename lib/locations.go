@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// LocationRegion links an upstream location id to a region name and the
+// StarLocations catalog entries that the id is expected to be called as.
+type LocationRegion struct {
+	Id      int      `json:"id"`
+	Region  string   `json:"region"`
+	Catalog []string `json:"catalog"`
+}
+
+var LocationRegions map[int]*LocationRegion
+
+var loggedMismatches = make(map[string]bool)
+
+func init() {
+	LocationRegions = make(map[int]*LocationRegion)
+	if len(LocationsFile) == 0 {
+		return
+	}
+
+	regions, err := loadLocationRegions(LocationsFile)
+	if err != nil {
+		log.Println("Failed to load location registry from", LocationsFile)
+		panic(err)
+	}
+	for _, region := range regions {
+		for _, entry := range region.Catalog {
+			if _, ok := StarLocations[entry]; !ok {
+				log.Printf("Location %d references unknown catalog entry '%s'\n", region.Id, entry)
+			}
+		}
+		LocationRegions[region.Id] = region
+	}
+}
+
+func loadLocationRegions(filePath string) ([]*LocationRegion, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read locations file: %w", err)
+	}
+
+	var regions []*LocationRegion
+	if err = json.Unmarshal(content, &regions); err != nil {
+		return nil, fmt.Errorf("failed to parse locations file: %w", err)
+	}
+	return regions, nil
+}
+
+func GetLocationRegion(id int) *LocationRegion {
+	return LocationRegions[id]
+}
+
+// GetRegionName returns the region of a star, preferring the registry entry
+// of the upstream id over the region of the mapped catalog entry.
+func GetRegionName(id int, location *StarLocation) string {
+	if region := GetLocationRegion(id); region != nil && len(region.Region) > 0 {
+		return region.Region
+	}
+	if location != nil {
+		return location.Region
+	}
+	return ""
+}
+
+// IsLocationAllowed matches ALLOWED_LOCATIONS entries against the upstream
+// location id, or by name against the region and catalog entry of the star.
+func IsLocationAllowed(id int, location *StarLocation) bool {
+	if len(AllowedLocations) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(AllowedLocations, func(allowed string) bool {
+		return matchesLocation(allowed, id, location)
+	})
+}
+
+func matchesLocation(filter string, id int, location *StarLocation) bool {
+	filter = strings.TrimSpace(filter)
+	if filterId, err := strconv.Atoi(filter); err == nil {
+		return filterId == id
+	}
+
+	if strings.EqualFold(filter, GetRegionName(id, location)) {
+		return true
+	}
+	if location != nil {
+		return strings.EqualFold(filter, location.Region) || strings.EqualFold(filter, location.Name)
+	}
+	return false
+}
+
+// CheckLocationMismatch logs stars whose called location text maps to a
+// catalog entry that is not linked to the upstream location id. Each
+// combination is only logged once.
+func CheckLocationMismatch(id int, calledLocation string, location *StarLocation) bool {
+	region := GetLocationRegion(id)
+	if region == nil || location == nil || len(region.Catalog) == 0 {
+		return false
+	}
+	if slices.Contains(region.Catalog, location.Name) {
+		return false
+	}
+
+	key := fmt.Sprintf("%d|%s", id, location.Name)
+	if !loggedMismatches[key] {
+		loggedMismatches[key] = true
+		log.Printf(
+			"Location mismatch: id %d (%s) is linked to %v but '%s' was called as '%s'\n",
+			id, region.Region, region.Catalog, calledLocation, location.Name,
+		)
+	}
+	return true
+}
@@ -0,0 +1,281 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"star-notifier/lib/db"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type MatrixMessage struct {
+	MsgType       string          `json:"msgtype"`
+	Body          string          `json:"body"`
+	Format        string          `json:"format,omitempty"`
+	FormattedBody string          `json:"formatted_body,omitempty"`
+	NewContent    *MatrixMessage  `json:"m.new_content,omitempty"`
+	RelatesTo     *MatrixRelation `json:"m.relates_to,omitempty"`
+}
+
+type MatrixRelation struct {
+	RelType string `json:"rel_type"`
+	EventId string `json:"event_id"`
+}
+
+type matrixEventResponse struct {
+	EventId string `json:"event_id"`
+}
+
+type matrixUploadResponse struct {
+	ContentUri string `json:"content_uri"`
+}
+
+// MatrixNotifier posts new stars to rooms and keeps one listing message per
+// room current by sending m.replace edits of the original event.
+type MatrixNotifier struct {
+	homeserverUrl string
+	accessToken   string
+	roomIds       []string
+	database      *db.Database
+
+	transactionId atomic.Int64
+	thumbnailUris map[string]string
+}
+
+func NewMatrixNotifier(homeserverUrl, accessToken string, roomIds []string, database *db.Database) *MatrixNotifier {
+	return &MatrixNotifier{
+		homeserverUrl: strings.TrimSuffix(homeserverUrl, "/"),
+		accessToken:   accessToken,
+		roomIds:       roomIds,
+		database:      database,
+		thumbnailUris: make(map[string]string),
+	}
+}
+
+func (notifier *MatrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (notifier *MatrixNotifier) PostListing(stars *[]*Star) error {
+	message := notifier.createListingMessage(stars)
+	for _, roomId := range notifier.roomIds {
+		notifier.postListingMessage(roomId, message)
+	}
+	return nil
+}
+
+func (notifier *MatrixNotifier) UpdateListing(stars *[]*Star) error {
+	message := notifier.createListingMessage(stars)
+	for _, roomId := range notifier.roomIds {
+		eventId := notifier.database.GetListingMessage(matrixKey(roomId))
+		if eventId == nil || len(*eventId) == 0 {
+			log.Println("Matrix listing message does not exist for", roomId, "-- posting new message...")
+			notifier.postListingMessage(roomId, message)
+			continue
+		}
+
+		edit := &MatrixMessage{
+			MsgType:       message.MsgType,
+			Body:          "* " + message.Body,
+			Format:        message.Format,
+			FormattedBody: "* " + message.FormattedBody,
+			NewContent:    message,
+			RelatesTo: &MatrixRelation{
+				RelType: "m.replace",
+				EventId: *eventId,
+			},
+		}
+		_, statusCode, err := notifier.sendMessage(roomId, edit)
+		if err == nil {
+			continue
+		}
+		// edits of redacted events, or of events in a room the bot can no
+		// longer post to, are rejected
+		if statusCode >= 400 && statusCode < 500 && statusCode != http.StatusTooManyRequests {
+			log.Println("Failed to edit Matrix listing message in", roomId, "-- posting new listing message:", err)
+			notifier.postListingMessage(roomId, message)
+			continue
+		}
+		log.Println("Failed to edit Matrix listing message in", roomId, "--", err)
+	}
+	return nil
+}
+
+func (notifier *MatrixNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	stars = sortedStars(stars)
+	var lines, htmlLines []string
+	for _, star := range *stars {
+		lines = append(lines, "New star: "+formatPlainStarLine(star, timestamp))
+		htmlLines = append(htmlLines, "⭐ <b>New star:</b> "+html.EscapeString(formatPlainStarLine(star, timestamp)))
+	}
+	message := &MatrixMessage{
+		MsgType:       "m.text",
+		Body:          strings.Join(lines, "\n"),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: strings.Join(htmlLines, "<br>"),
+	}
+
+	for _, roomId := range notifier.roomIds {
+		eventId, _, err := notifier.sendMessage(roomId, message)
+		if err != nil {
+			log.Println("Failed to post new stars to Matrix room", roomId, err)
+			continue
+		}
+		notifier.database.AddNewStarMessage(matrixKey(roomId), eventId, timestamp)
+		notifier.database.SaveUnsafe()
+	}
+	return nil
+}
+
+func (notifier *MatrixNotifier) RetractMessages(timestamp int64) error {
+	for _, roomId := range notifier.roomIds {
+		oldMessages := notifier.database.GetOldNewStarMessages(matrixKey(roomId), NewStarMessageMaxAge)
+		if len(*oldMessages) == 0 {
+			continue
+		}
+		for _, message := range *oldMessages {
+			path := fmt.Sprintf(
+				"/_matrix/client/v3/rooms/%s/redact/%s/%s",
+				url.PathEscape(roomId), url.PathEscape(message.MessageId), notifier.nextTransactionId(),
+			)
+			if _, err := sendJson(http.MethodPut, notifier.homeserverUrl+path, notifier.headers(), map[string]string{}, nil); err != nil {
+				log.Printf("Failed to redact Matrix event %s from %s: %v\n", message.MessageId, roomId, err)
+			}
+		}
+		notifier.database.RemoveNewStarMessages(oldMessages)
+		notifier.database.SaveUnsafe()
+	}
+	return nil
+}
+
+func (notifier *MatrixNotifier) postListingMessage(roomId string, message *MatrixMessage) {
+	eventId, _, err := notifier.sendMessage(roomId, message)
+	if err != nil {
+		log.Println("Failed to post Matrix listing message to", roomId, err)
+		return
+	}
+	notifier.database.SetListingMessage(matrixKey(roomId), eventId)
+	notifier.database.SaveUnsafe()
+}
+
+func (notifier *MatrixNotifier) sendMessage(roomId string, message *MatrixMessage) (string, int, error) {
+	path := fmt.Sprintf(
+		"/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		url.PathEscape(roomId), notifier.nextTransactionId(),
+	)
+	var response matrixEventResponse
+	statusCode, err := sendJson(http.MethodPut, notifier.homeserverUrl+path, notifier.headers(), message, &response)
+	if err != nil {
+		return "", statusCode, err
+	}
+	return response.EventId, statusCode, nil
+}
+
+// uploadThumbnail uploads a map thumbnail to the media repository once and
+// returns its mxc uri.
+func (notifier *MatrixNotifier) uploadThumbnail(location *StarLocation) (string, error) {
+	key := fmt.Sprintf("%d_%d", location.X, location.Y)
+	if contentUri, ok := notifier.thumbnailUris[key]; ok {
+		return contentUri, nil
+	}
+
+	thumbnail, err := GetThumbnail(location.X, location.Y, MapWidth, MapHeight)
+	if err != nil {
+		return "", err
+	}
+	uploadUrl := fmt.Sprintf("%s/_matrix/media/v3/upload?filename=map%s.png", notifier.homeserverUrl, key)
+	req, err := http.NewRequest(http.MethodPost, uploadUrl, bytes.NewReader(thumbnail))
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", "image/png")
+	req.Header.Set("Authorization", "Bearer "+notifier.accessToken)
+
+	var response matrixUploadResponse
+	if _, err = doRequest(req, &response); err != nil {
+		return "", fmt.Errorf("failed to upload thumbnail: %w", err)
+	}
+	notifier.thumbnailUris[key] = response.ContentUri
+	return response.ContentUri, nil
+}
+
+func (notifier *MatrixNotifier) createListingMessage(stars *[]*Star) *MatrixMessage {
+	stars = sortedStars(stars)
+	now := time.Now().Unix()
+
+	var lines, htmlLines []string
+	var starLocations []*StarLocation
+	for _, star := range *stars {
+		line := formatPlainStarLine(star, now)
+		lines = append(lines, line)
+		htmlLines = append(htmlLines, html.EscapeString(line))
+
+		if star.MappedLocation != nil && !containsLocation(starLocations, star.MappedLocation) {
+			starLocations = append(starLocations, star.MappedLocation)
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No stars at the moment :(")
+		htmlLines = append(htmlLines, "No stars at the moment :(")
+	}
+
+	for _, location := range starLocations {
+		contentUri, err := notifier.uploadThumbnail(location)
+		if err != nil {
+			log.Println("Failed to upload Matrix thumbnail:", err)
+			continue
+		}
+		htmlLines = append(htmlLines, fmt.Sprintf(
+			`<img src="%s" alt="%s" width="%d" height="%d">`,
+			contentUri, html.EscapeString(location.Name), MapWidth, MapHeight,
+		))
+	}
+
+	return &MatrixMessage{
+		MsgType:       "m.text",
+		Body:          strings.Join(lines, "\n"),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: strings.Join(htmlLines, "<br>"),
+	}
+}
+
+func (notifier *MatrixNotifier) headers() map[string]string {
+	return map[string]string{
+		"Authorization": "Bearer " + notifier.accessToken,
+	}
+}
+
+func (notifier *MatrixNotifier) nextTransactionId() string {
+	return fmt.Sprintf("star-notifier-%d-%d", time.Now().UnixNano(), notifier.transactionId.Add(1))
+}
+
+func matrixKey(roomId string) string {
+	return "matrix:" + roomId
+}
+
+// formatPlainStarLine formats a star for platforms without markup or client
+// side time formatting.
+func formatPlainStarLine(star *Star, now int64) string {
+	return fmt.Sprintf(
+		"[World %d, tier %d] %s (est. depletion: %s)%s",
+		star.World,
+		star.Tier,
+		star.CalledLocation,
+		formatRelativeTime(star.DepleteTime, now),
+		formatHomePointDistance(star),
+	)
+}
+
+func containsLocation(locations []*StarLocation, location *StarLocation) bool {
+	for _, other := range locations {
+		if other.X == location.X && other.Y == location.Y {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRoomId = "!room:example.org"
+
+func TestMatrixNotifierListing(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return matrixEventResponse{EventId: "$listing"}
+	})
+	database := newTestDatabase(t)
+	notifier := NewMatrixNotifier(server.URL+"/", "token", []string{testRoomId}, database)
+
+	if err := notifier.PostListing(testStars()); err != nil {
+		t.Fatalf("PostListing failed: %v", err)
+	}
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Method != http.MethodPut ||
+		!strings.HasPrefix(requests[0].Path, "/_matrix/client/v3/rooms/"+testRoomId+"/send/m.room.message/") {
+		t.Fatalf("unexpected requests for posting the listing: %+v", requests)
+	}
+	if requests[0].Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("unexpected authorization header %q", requests[0].Header.Get("Authorization"))
+	}
+	if eventId := database.GetListingMessage(matrixKey(testRoomId)); eventId == nil || *eventId != "$listing" {
+		t.Fatalf("listing message was not stored: %v", eventId)
+	}
+
+	if err := notifier.UpdateListing(testStars()); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	requests = server.take()
+	if len(requests) != 1 {
+		t.Fatalf("unexpected requests for editing the listing: %+v", requests)
+	}
+	edit := requests[0].Body
+	relation, _ := edit["m.relates_to"].(map[string]any)
+	if relation["rel_type"] != "m.replace" || relation["event_id"] != "$listing" {
+		t.Errorf("edit does not replace the listing message: %+v", edit)
+	}
+	newContent, _ := edit["m.new_content"].(map[string]any)
+	if !strings.HasPrefix(edit["body"].(string), "* ") || newContent["body"] != strings.TrimPrefix(edit["body"].(string), "* ") {
+		t.Errorf("unexpected edit content: %+v", edit)
+	}
+}
+
+func TestMatrixNotifierNewStars(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return matrixEventResponse{EventId: "$star"}
+	})
+	database := newTestDatabase(t)
+	notifier := NewMatrixNotifier(server.URL, "token", []string{testRoomId}, database)
+
+	postedAt := time.Now().Unix() - int64(NewStarMessageMaxAge) - 1
+	if err := notifier.AnnounceNewStars(testStars(), postedAt); err != nil {
+		t.Fatalf("AnnounceNewStars failed: %v", err)
+	}
+	requests := server.take()
+	if len(requests) != 1 || !strings.Contains(requests[0].Path, "/send/m.room.message/") {
+		t.Fatalf("unexpected requests for posting new stars: %+v", requests)
+	}
+	if body := requests[0].Body["body"].(string); !strings.HasPrefix(body, "New star: [World 330, tier 8] Aldarin") {
+		t.Errorf("unexpected message body %q", body)
+	}
+
+	if err := notifier.RetractMessages(time.Now().Unix()); err != nil {
+		t.Fatalf("RetractMessages failed: %v", err)
+	}
+	requests = server.take()
+	if len(requests) != 1 || requests[0].Method != http.MethodPut ||
+		!strings.HasPrefix(requests[0].Path, "/_matrix/client/v3/rooms/"+testRoomId+"/redact/$star/") {
+		t.Fatalf("unexpected requests for retracting new stars: %+v", requests)
+	}
+	if messages := database.GetOldNewStarMessages(matrixKey(testRoomId), 0); len(*messages) != 0 {
+		t.Errorf("retracted messages are still stored: %+v", *messages)
+	}
+}
+
+func TestMatrixNotifierRepostsRejectedEdit(t *testing.T) {
+	for _, test := range []struct {
+		status  int
+		reposts bool
+	}{
+		{http.StatusBadRequest, true},
+		{http.StatusForbidden, true},
+		{http.StatusTooManyRequests, false},
+		{http.StatusBadGateway, false},
+	} {
+		var lock sync.Mutex
+		var requests []map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			var body map[string]any
+			_ = json.NewDecoder(request.Body).Decode(&body)
+			lock.Lock()
+			requests = append(requests, body)
+			lock.Unlock()
+			if _, edit := body["m.relates_to"]; edit {
+				writer.WriteHeader(test.status)
+				_, _ = writer.Write([]byte(`{"errcode":"M_UNKNOWN"}`))
+				return
+			}
+			_ = json.NewEncoder(writer).Encode(matrixEventResponse{EventId: "$new"})
+		}))
+		database := newTestDatabase(t)
+		database.SetListingMessage(matrixKey(testRoomId), "$redacted")
+		notifier := NewMatrixNotifier(server.URL, "token", []string{testRoomId}, database)
+
+		if err := notifier.UpdateListing(testStars()); err != nil {
+			t.Fatalf("UpdateListing failed: %v", err)
+		}
+		server.Close()
+
+		expected, eventId := 1, "$redacted"
+		if test.reposts {
+			expected, eventId = 2, "$new"
+		}
+		if len(requests) != expected {
+			t.Errorf("status %d: expected %d request(s), got %d", test.status, expected, len(requests))
+		}
+		if stored := database.GetListingMessage(matrixKey(testRoomId)); stored == nil || *stored != eventId {
+			t.Errorf("status %d: unexpected listing message %v", test.status, stored)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"star-notifier/lib/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuietHours is a daily window given as "HH:MM" times in the time zone of the
+// webhook. Windows ending before they start span midnight.
+type QuietHours struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// FilterMentions drops roles that are in cooldown or would be mentioned during
+// quiet hours. The message itself is still posted, just without the mention.
+func (webhook *Webhook) FilterMentions(roleIds []string, timestamp int64, database *db.Database) []string {
+	if len(roleIds) == 0 {
+		return roleIds
+	}
+
+	if webhook.IsQuietTime(timestamp) {
+		log.Printf("Suppressing mention(s) of %v for %s: quiet hours\n", roleIds, webhook.Url)
+		return nil
+	}
+
+	var allowed []string
+	for _, roleId := range roleIds {
+		cooldown := webhook.getMentionCooldown(roleId)
+		lastMention := database.GetLastMention(webhook.Url, roleId)
+		if cooldown > 0 && timestamp-lastMention < int64(cooldown) {
+			log.Printf(
+				"Suppressing mention of %s for %s: in cooldown for %ds\n",
+				roleId, webhook.Url, int64(cooldown)-(timestamp-lastMention),
+			)
+			continue
+		}
+		allowed = append(allowed, roleId)
+	}
+	return allowed
+}
+
+func (webhook *Webhook) RecordMentions(roleIds []string, timestamp int64, database *db.Database) {
+	for _, roleId := range roleIds {
+		database.SetLastMention(webhook.Url, roleId, timestamp)
+	}
+}
+
+func (webhook *Webhook) getMentionCooldown(roleId string) int {
+	for _, rule := range webhook.MentionRules {
+		if rule.RoleId == roleId && rule.Cooldown > 0 {
+			return rule.Cooldown
+		}
+	}
+	return webhook.MentionCooldown
+}
+
+func (webhook *Webhook) IsQuietTime(timestamp int64) bool {
+	if len(webhook.QuietHours) == 0 {
+		return false
+	}
+
+	now := time.Unix(timestamp, 0).In(webhook.timeLocation)
+	minute := now.Hour()*60 + now.Minute()
+	for _, quietHours := range webhook.QuietHours {
+		start, errStart := parseClock(quietHours.Start)
+		end, errEnd := parseClock(quietHours.End)
+		if errStart != nil || errEnd != nil {
+			continue
+		}
+		if start <= end && minute >= start && minute < end {
+			return true
+		}
+		if start > end && (minute >= start || minute < end) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseClock returns the minute of the day of a "HH:MM" time.
+func parseClock(clock string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(clock), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time '%s'", clock)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 23 {
+		return 0, fmt.Errorf("invalid hours in '%s'", clock)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid minutes in '%s'", clock)
+	}
+	return hours*60 + minutes, nil
+}
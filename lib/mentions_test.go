@@ -0,0 +1,119 @@
+package lib
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQueueNewStarsMentionCooldown(t *testing.T) {
+	now := time.Now().Unix()
+	stars := &[]*Star{
+		{CalledLocation: "Aldarin", Tier: 8, World: 330, DepleteTime: now + 600},
+		{CalledLocation: "Aldarin", Tier: 7, World: 331, DepleteTime: now + 600},
+	}
+
+	for _, test := range []struct {
+		name       string
+		threadName string
+		batches    int
+	}{
+		// a post, and a message, for every star of the batch
+		{"forum posts of one batch", "W{world} T{tier}", 1},
+		// the first message is still pending when the second is queued
+		{"pending messages", "", 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			webhook := &Webhook{
+				Url:        "https://discord.com/api/webhooks/1/token",
+				ThreadName: test.threadName,
+				MentionRules: []MentionRule{
+					{RoleId: "stars", Cooldown: 600, StarFilter: StarFilter{MinTier: 7}},
+				},
+			}
+			webhook.applyDefaults()
+			database := newTestDatabase(t)
+			notifier := NewDiscordNotifier([]*Webhook{webhook}, database)
+
+			for batch := 0; batch < test.batches; batch++ {
+				notifier.queueNewStars(webhook, stars, now+int64(batch), false)
+			}
+
+			entries := database.GetOutboxEntries(webhook.Url)
+			if len(entries) != 2 {
+				t.Fatalf("expected 2 queued messages, got %d", len(entries))
+			}
+			if !slices.Equal(entries[0].RoleIds, []string{"stars"}) {
+				t.Errorf("first message does not mention the role: %v", entries[0].RoleIds)
+			}
+			if len(entries[1].RoleIds) > 0 {
+				t.Errorf("second message mentions %v during the cooldown", entries[1].RoleIds)
+			}
+		})
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for _, test := range []struct {
+		clock  string
+		minute int
+		valid  bool
+	}{
+		{"00:00", 0, true},
+		{"7:05", 425, true},
+		{" 23:59 ", 1439, true},
+		{"24:00", 0, false},
+		{"12:60", 0, false},
+		{"-1:30", 0, false},
+		{"12", 0, false},
+		{"12:30:00", 0, false},
+		{"noon", 0, false},
+	} {
+		minute, err := parseClock(test.clock)
+		if (err == nil) != test.valid || minute != test.minute {
+			t.Errorf("parseClock(%q) = %d, %v", test.clock, minute, err)
+		}
+	}
+}
+
+func TestIsQuietTime(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		quietHours []QuietHours
+		hour, min  int
+		quiet      bool
+	}{
+		{"no quiet hours", nil, 3, 0, false},
+		{"within the day", []QuietHours{{"09:00", "17:00"}}, 12, 0, true},
+		{"at the start", []QuietHours{{"09:00", "17:00"}}, 9, 0, true},
+		{"at the end", []QuietHours{{"09:00", "17:00"}}, 17, 0, false},
+		{"before midnight", []QuietHours{{"22:00", "07:00"}}, 23, 30, true},
+		{"after midnight", []QuietHours{{"22:00", "07:00"}}, 2, 0, true},
+		{"outside across midnight", []QuietHours{{"22:00", "07:00"}}, 12, 0, false},
+		{"end across midnight", []QuietHours{{"22:00", "07:00"}}, 7, 0, false},
+		{"second window", []QuietHours{{"01:00", "02:00"}, {"13:00", "14:00"}}, 13, 30, true},
+		{"invalid window", []QuietHours{{"25:00", "07:00"}}, 3, 0, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			webhook := &Webhook{Url: "https://discord.com/api/webhooks/1/token", QuietHours: test.quietHours, TimeZone: "UTC"}
+			webhook.applyDefaults()
+			timestamp := time.Date(2026, time.March, 1, test.hour, test.min, 0, 0, time.UTC).Unix()
+			if quiet := webhook.IsQuietTime(timestamp); quiet != test.quiet {
+				t.Errorf("quiet at %02d:%02d is %v, expected %v", test.hour, test.min, quiet, test.quiet)
+			}
+		})
+	}
+}
+
+func TestIsQuietTimeInTimeZone(t *testing.T) {
+	webhook := &Webhook{
+		Url:        "https://discord.com/api/webhooks/1/token",
+		QuietHours: []QuietHours{{"22:00", "07:00"}},
+		TimeZone:   "Asia/Tokyo",
+	}
+	webhook.applyDefaults()
+	// 23:00 in Tokyo
+	if !webhook.IsQuietTime(time.Date(2026, time.March, 1, 14, 0, 0, 0, time.UTC).Unix()) {
+		t.Error("quiet hours are not in the time zone of the webhook")
+	}
+}
@@ -0,0 +1,292 @@
+package lib
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"star-notifier/lib/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mqttPacketConnect    = 0x10
+	mqttPacketConnAck    = 0x20
+	mqttPacketPublish    = 0x30
+	mqttPacketDisconnect = 0xe0
+)
+
+var topicSanitizer = regexp.MustCompile(`[^a-z0-9]+`)
+
+type mqttEvent struct {
+	Type      string       `json:"type"`
+	Timestamp int64        `json:"timestamp"`
+	Star      *StarPayload `json:"star"`
+}
+
+// MqttNotifier publishes retained json state for each active star under
+// <prefix>/<world>/<location>, clears it when the star depletes, and publishes
+// transient events under <prefix>/events/<type>. Only QoS 0 is used, so a
+// short lived connection is opened for every batch of publishes. The topics
+// with retained state are stored, so that they are cleared after a restart.
+type MqttNotifier struct {
+	brokerUrl   *url.URL
+	topicPrefix string
+	clientId    string
+	username    string
+	password    string
+	database    *db.Database
+}
+
+type mqttMessage struct {
+	topic    string
+	payload  []byte
+	retained bool
+}
+
+func NewMqttNotifier(brokerUrl, topicPrefix, clientId, username, password string, database *db.Database) (*MqttNotifier, error) {
+	parsedUrl, err := url.Parse(brokerUrl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse broker url: %w", err)
+	}
+	if parsedUrl.Scheme != "tcp" && parsedUrl.Scheme != "mqtt" {
+		return nil, fmt.Errorf("unsupported broker url scheme '%s'", parsedUrl.Scheme)
+	}
+	return &MqttNotifier{
+		brokerUrl:   parsedUrl,
+		topicPrefix: strings.TrimSuffix(topicPrefix, "/"),
+		clientId:    clientId,
+		username:    username,
+		password:    password,
+		database:    database,
+	}, nil
+}
+
+func (notifier *MqttNotifier) Name() string {
+	return "mqtt"
+}
+
+func (notifier *MqttNotifier) PostListing(stars *[]*Star) error {
+	return notifier.UpdateListing(stars)
+}
+
+// UpdateListing republishes the retained state of every active star so that
+// the broker holds current state even after it lost its retained messages,
+// and clears topics of stars that disappeared without a depletion event.
+func (notifier *MqttNotifier) UpdateListing(stars *[]*Star) error {
+	var messages []mqttMessage
+	var activeTopics []string
+	for _, star := range *stars {
+		payload, err := json.Marshal(star.Payload())
+		if err != nil {
+			return fmt.Errorf("failed to encode star: %w", err)
+		}
+		topic := notifier.starTopic(star)
+		activeTopics = append(activeTopics, topic)
+		messages = append(messages, mqttMessage{topic: topic, payload: payload, retained: true})
+	}
+	for _, topic := range notifier.database.GetRetainedTopics() {
+		if !slices.Contains(activeTopics, topic) {
+			messages = append(messages, mqttMessage{topic: topic, payload: nil, retained: true})
+		}
+	}
+
+	if err := notifier.publish(messages); err != nil {
+		return err
+	}
+	notifier.database.SetRetainedTopics(activeTopics)
+	notifier.database.SaveUnsafe()
+	return nil
+}
+
+func (notifier *MqttNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	var messages []mqttMessage
+	for _, star := range *stars {
+		state, err := json.Marshal(star.Payload())
+		if err != nil {
+			return fmt.Errorf("failed to encode star: %w", err)
+		}
+		event, err := json.Marshal(mqttEvent{Type: EventNewStar, Timestamp: timestamp, Star: star.Payload()})
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		messages = append(messages,
+			mqttMessage{topic: notifier.starTopic(star), payload: state, retained: true},
+			mqttMessage{topic: notifier.eventTopic(EventNewStar), payload: event},
+		)
+	}
+	return notifier.publish(messages)
+}
+
+func (notifier *MqttNotifier) NotifyChanges(changes *StarChanges, timestamp int64) error {
+	var messages []mqttMessage
+	for _, star := range changes.Updated {
+		state, err := json.Marshal(star.Payload())
+		if err != nil {
+			return fmt.Errorf("failed to encode star: %w", err)
+		}
+		event, err := json.Marshal(mqttEvent{Type: EventTierUpdate, Timestamp: timestamp, Star: star.Payload()})
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		messages = append(messages,
+			mqttMessage{topic: notifier.starTopic(star), payload: state, retained: true},
+			mqttMessage{topic: notifier.eventTopic(EventTierUpdate), payload: event},
+		)
+	}
+	for _, star := range changes.Depleted {
+		event, err := json.Marshal(mqttEvent{Type: EventDepleted, Timestamp: timestamp, Star: star.Payload()})
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		// an empty retained payload removes the retained message
+		messages = append(messages,
+			mqttMessage{topic: notifier.starTopic(star), payload: nil, retained: true},
+			mqttMessage{topic: notifier.eventTopic(EventDepleted), payload: event},
+		)
+	}
+	return notifier.publish(messages)
+}
+
+func (notifier *MqttNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+func (notifier *MqttNotifier) starTopic(star *Star) string {
+	location := star.CalledLocation
+	if star.MappedLocation != nil {
+		location = star.MappedLocation.Name
+	}
+	slug := strings.Trim(topicSanitizer.ReplaceAllString(strings.ToLower(location), "-"), "-")
+	return fmt.Sprintf("%s/%d/%s", notifier.topicPrefix, star.World, slug)
+}
+
+func (notifier *MqttNotifier) eventTopic(eventType string) string {
+	return fmt.Sprintf("%s/events/%s", notifier.topicPrefix, strings.ReplaceAll(eventType, ".", "/"))
+}
+
+func (notifier *MqttNotifier) publish(messages []mqttMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	host := notifier.brokerUrl.Host
+	if len(notifier.brokerUrl.Port()) == 0 {
+		host = net.JoinHostPort(notifier.brokerUrl.Hostname(), "1883")
+	}
+	conn, err := net.DialTimeout("tcp", host, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to broker: %w", err)
+	}
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	if err = conn.SetDeadline(time.Now().Add(30 * time.Second)); err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(conn)
+	if err = notifier.connect(writer, conn); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if err = writeMqttPublish(writer, message); err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", message.topic, err)
+		}
+	}
+	if err = writer.WriteByte(mqttPacketDisconnect); err != nil {
+		return err
+	}
+	if err = writer.WriteByte(0); err != nil {
+		return err
+	}
+	if err = writer.Flush(); err != nil {
+		return fmt.Errorf("failed to send messages: %w", err)
+	}
+	log.Printf("Published %d MQTT message(s)\n", len(messages))
+	return nil
+}
+
+func (notifier *MqttNotifier) connect(writer *bufio.Writer, reader io.Reader) error {
+	var flags byte = 0x02 // clean session
+	payload := mqttString(notifier.clientId)
+	if len(notifier.username) > 0 {
+		flags |= 0x80
+		payload = append(payload, mqttString(notifier.username)...)
+		if len(notifier.password) > 0 {
+			flags |= 0x40
+			payload = append(payload, mqttString(notifier.password)...)
+		}
+	}
+
+	body := mqttString("MQTT")
+	body = append(body, 0x04, flags)               // protocol level 3.1.1
+	body = binary.BigEndian.AppendUint16(body, 60) // keep alive seconds
+	body = append(body, payload...)
+	if err := writeMqttPacket(writer, mqttPacketConnect, body); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to send connect: %w", err)
+	}
+
+	connAck := make([]byte, 4)
+	if _, err := io.ReadFull(reader, connAck); err != nil {
+		return fmt.Errorf("failed to read connack: %w", err)
+	}
+	if connAck[0] != mqttPacketConnAck {
+		return fmt.Errorf("unexpected packet type %#x instead of connack", connAck[0])
+	}
+	if connAck[3] != 0 {
+		return fmt.Errorf("broker refused connection with code %d", connAck[3])
+	}
+	return nil
+}
+
+func writeMqttPublish(writer *bufio.Writer, message mqttMessage) error {
+	var header byte = mqttPacketPublish
+	if message.retained {
+		header |= 0x01
+	}
+	body := append(mqttString(message.topic), message.payload...)
+	return writeMqttPacket(writer, header, body)
+}
+
+func writeMqttPacket(writer *bufio.Writer, header byte, body []byte) error {
+	if err := writer.WriteByte(header); err != nil {
+		return err
+	}
+	// remaining length is encoded 7 bits at a time
+	length := len(body)
+	for {
+		encoded := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			encoded |= 0x80
+		}
+		if err := writer.WriteByte(encoded); err != nil {
+			return err
+		}
+		if length == 0 {
+			break
+		}
+	}
+	_, err := writer.Write(body)
+	return err
+}
+
+func mqttString(value string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(value))), value...)
+}
+
+func defaultMqttClientId() string {
+	return "star-notifier-" + strconv.FormatInt(time.Now().UnixNano()%1_000_000, 10)
+}
@@ -0,0 +1,270 @@
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"slices"
+	"testing"
+)
+
+type mqttPacket struct {
+	header byte
+	body   []byte
+}
+
+func readMqttPacket(reader *bufio.Reader) (*mqttPacket, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		encoded, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length += int(encoded&0x7f) * multiplier
+		multiplier *= 128
+		if encoded&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err = io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+	return &mqttPacket{header: header, body: body}, nil
+}
+
+// readMqttString reads a length prefixed string from the start of data and
+// returns it with the rest of data.
+func readMqttString(t *testing.T, data []byte) (string, []byte) {
+	if len(data) < 2 {
+		t.Fatalf("missing string length in %v", data)
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		t.Fatalf("string of length %d does not fit in %v", length, data)
+	}
+	return string(data[2 : 2+length]), data[2+length:]
+}
+
+func TestWriteMqttPacketRemainingLength(t *testing.T) {
+	for _, test := range []struct {
+		length  int
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+	} {
+		buffer := new(bytes.Buffer)
+		writer := bufio.NewWriter(buffer)
+		if err := writeMqttPacket(writer, mqttPacketPublish, make([]byte, test.length)); err != nil {
+			t.Fatalf("writeMqttPacket failed: %v", err)
+		}
+		_ = writer.Flush()
+
+		packet := buffer.Bytes()
+		if packet[0] != mqttPacketPublish {
+			t.Errorf("unexpected header %#x", packet[0])
+		}
+		if encoded := packet[1 : 1+len(test.encoded)]; !bytes.Equal(encoded, test.encoded) {
+			t.Errorf("remaining length %d encoded as %v, expected %v", test.length, encoded, test.encoded)
+		}
+		if len(packet) != 1+len(test.encoded)+test.length {
+			t.Errorf("packet of length %d has %d bytes", test.length, len(packet))
+		}
+	}
+}
+
+func TestWriteMqttPublish(t *testing.T) {
+	for _, retained := range []bool{false, true} {
+		buffer := new(bytes.Buffer)
+		writer := bufio.NewWriter(buffer)
+		err := writeMqttPublish(writer, mqttMessage{topic: "stars/330/aldarin", payload: []byte(`{"tier":8}`), retained: retained})
+		if err != nil {
+			t.Fatalf("writeMqttPublish failed: %v", err)
+		}
+		_ = writer.Flush()
+
+		packet, err := readMqttPacket(bufio.NewReader(buffer))
+		if err != nil {
+			t.Fatalf("failed to read packet: %v", err)
+		}
+		expectedHeader := byte(mqttPacketPublish)
+		if retained {
+			expectedHeader |= 0x01
+		}
+		if packet.header != expectedHeader {
+			t.Errorf("unexpected header %#x for retained %v", packet.header, retained)
+		}
+		// QoS 0 publishes have no packet identifier
+		topic, payload := readMqttString(t, packet.body)
+		if topic != "stars/330/aldarin" || string(payload) != `{"tier":8}` {
+			t.Errorf("unexpected topic %q and payload %q", topic, payload)
+		}
+	}
+}
+
+func TestMqttConnect(t *testing.T) {
+	for _, test := range []struct {
+		username, password string
+		flags              byte
+		payload            []string
+	}{
+		{"", "", 0x02, []string{"client"}},
+		{"user", "", 0x82, []string{"client", "user"}},
+		{"user", "secret", 0xc2, []string{"client", "user", "secret"}},
+	} {
+		notifier, err := NewMqttNotifier("tcp://localhost", "stars", "client", test.username, test.password, newTestDatabase(t))
+		if err != nil {
+			t.Fatalf("NewMqttNotifier failed: %v", err)
+		}
+
+		client, broker := net.Pipe()
+		packets := make(chan *mqttPacket, 1)
+		go func() {
+			packet, err := readMqttPacket(bufio.NewReader(broker))
+			if err != nil {
+				close(packets)
+				return
+			}
+			packets <- packet
+			_, _ = broker.Write([]byte{mqttPacketConnAck, 0x02, 0x00, 0x00})
+		}()
+
+		if err = notifier.connect(bufio.NewWriter(client), client); err != nil {
+			t.Fatalf("connect failed: %v", err)
+		}
+		packet := <-packets
+		if packet == nil || packet.header != mqttPacketConnect {
+			t.Fatalf("unexpected connect packet %+v", packet)
+		}
+
+		protocol, rest := readMqttString(t, packet.body)
+		if protocol != "MQTT" || rest[0] != 0x04 || rest[1] != test.flags {
+			t.Errorf("unexpected variable header %q %v", protocol, rest[:2])
+		}
+		if keepAlive := binary.BigEndian.Uint16(rest[2:4]); keepAlive != 60 {
+			t.Errorf("unexpected keep alive %d", keepAlive)
+		}
+		rest = rest[4:]
+		var payload []string
+		for len(rest) > 0 {
+			var value string
+			value, rest = readMqttString(t, rest)
+			payload = append(payload, value)
+		}
+		if !slices.Equal(payload, test.payload) {
+			t.Errorf("unexpected connect payload %v, expected %v", payload, test.payload)
+		}
+		_ = client.Close()
+		_ = broker.Close()
+	}
+}
+
+func TestMqttConnectRefused(t *testing.T) {
+	notifier, err := NewMqttNotifier("tcp://localhost", "stars", "client", "", "", newTestDatabase(t))
+	if err != nil {
+		t.Fatalf("NewMqttNotifier failed: %v", err)
+	}
+	client, broker := net.Pipe()
+	defer func() {
+		_ = client.Close()
+		_ = broker.Close()
+	}()
+	go func() {
+		_, _ = readMqttPacket(bufio.NewReader(broker))
+		// not authorized
+		_, _ = broker.Write([]byte{mqttPacketConnAck, 0x02, 0x00, 0x05})
+	}()
+
+	if err = notifier.connect(bufio.NewWriter(client), client); err == nil {
+		t.Fatal("connect succeeded although the broker refused the connection")
+	}
+}
+
+// fakeMqttBroker accepts connections and sends the publishes received in
+// each of them.
+func fakeMqttBroker(t *testing.T) (string, <-chan []mqttMessage) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	sessions := make(chan []mqttMessage, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(conn)
+			var messages []mqttMessage
+			for {
+				packet, err := readMqttPacket(reader)
+				if err != nil {
+					break
+				}
+				if packet.header == mqttPacketConnect {
+					_, _ = conn.Write([]byte{mqttPacketConnAck, 0x02, 0x00, 0x00})
+				} else if packet.header&0xf0 == mqttPacketPublish {
+					length := int(binary.BigEndian.Uint16(packet.body))
+					messages = append(messages, mqttMessage{
+						topic:    string(packet.body[2 : 2+length]),
+						payload:  packet.body[2+length:],
+						retained: packet.header&0x01 != 0,
+					})
+				} else if packet.header == mqttPacketDisconnect {
+					break
+				}
+			}
+			_ = conn.Close()
+			sessions <- messages
+		}
+	}()
+	return "tcp://" + listener.Addr().String(), sessions
+}
+
+func TestMqttNotifierClearsRetainedTopicsAfterRestart(t *testing.T) {
+	brokerUrl, sessions := fakeMqttBroker(t)
+	database := newTestDatabase(t)
+
+	notifier, err := NewMqttNotifier(brokerUrl, "stars", "client", "", "", database)
+	if err != nil {
+		t.Fatalf("NewMqttNotifier failed: %v", err)
+	}
+	if err = notifier.UpdateListing(testStars()); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	messages := <-sessions
+	if len(messages) != 1 || messages[0].topic != "stars/330/aldarin" || !messages[0].retained || len(messages[0].payload) == 0 {
+		t.Fatalf("unexpected publishes for the listing: %+v", messages)
+	}
+
+	// a new notifier, as after a restart, still knows the retained topic
+	notifier, err = NewMqttNotifier(brokerUrl, "stars", "client", "", "", database)
+	if err != nil {
+		t.Fatalf("NewMqttNotifier failed: %v", err)
+	}
+	if err = notifier.UpdateListing(&[]*Star{}); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	messages = <-sessions
+	if len(messages) != 1 || messages[0].topic != "stars/330/aldarin" || !messages[0].retained || len(messages[0].payload) != 0 {
+		t.Fatalf("retained topic was not cleared: %+v", messages)
+	}
+	if topics := database.GetRetainedTopics(); len(topics) != 0 {
+		t.Errorf("cleared topics are still stored: %v", topics)
+	}
+}
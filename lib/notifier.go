@@ -0,0 +1,92 @@
+package lib
+
+import (
+	"log"
+	"net/http"
+	"star-notifier/lib/db"
+)
+
+// Notifier delivers star listings and new star announcements to a platform.
+type Notifier interface {
+	Name() string
+	// PostListing posts a new listing message, replacing any stored one.
+	PostListing(stars *[]*Star) error
+	// UpdateListing edits the stored listing message, posting a new one if
+	// it does not exist.
+	UpdateListing(stars *[]*Star) error
+	AnnounceNewStars(stars *[]*Star, timestamp int64) error
+	// RetractMessages removes announcements that have outlived their
+	// retention.
+	RetractMessages(timestamp int64) error
+}
+
+// ScheduledNotifier is implemented by notifiers that have work to do on every
+// cycle of the main loop, such as flushing digests.
+type ScheduledNotifier interface {
+	Tick(timestamp int64) error
+}
+
+func CreateNotifiers(database *db.Database) []Notifier {
+	var notifiers []Notifier
+	if len(Webhooks) > 0 || hasDiscordMessages(database) {
+		notifiers = append(notifiers, NewDiscordNotifier(Webhooks, database))
+	}
+	if len(SlackWebhookUrls) > 0 || (len(SlackBotToken) > 0 && len(SlackChannels) > 0) {
+		notifiers = append(notifiers, NewSlackNotifier(SlackApiUrl, SlackBotToken, SlackWebhookUrls, SlackChannels, database))
+	}
+	if len(TelegramBotToken) > 0 && len(TelegramChatIds) > 0 {
+		notifiers = append(notifiers, NewTelegramNotifier(TelegramApiUrl, TelegramBotToken, TelegramChatIds, database))
+	}
+	if len(JsonWebhookUrls) > 0 {
+		notifiers = append(notifiers, NewJsonWebhookNotifier(JsonWebhookUrls, JsonWebhookSecret, JsonWebhookRetries))
+	}
+	if len(MatrixHomeserverUrl) > 0 && len(MatrixAccessToken) > 0 && len(MatrixRoomIds) > 0 {
+		notifiers = append(notifiers, NewMatrixNotifier(MatrixHomeserverUrl, MatrixAccessToken, MatrixRoomIds, database))
+	}
+	if len(SmtpHost) > 0 {
+		recipients, err := LoadEmailRecipients()
+		if err != nil {
+			log.Println("Failed to load email recipients")
+			panic(err)
+		}
+		smtpConfig := SmtpConfig{
+			Host:     SmtpHost,
+			Port:     SmtpPort,
+			Username: SmtpUsername,
+			Password: SmtpPassword,
+			From:     SmtpFrom,
+			StartTls: SmtpStartTls,
+		}
+		notifiers = append(notifiers, NewEmailNotifier(smtpConfig, recipients, EmailDigestInterval, database))
+	}
+	if len(NtfyTopicUrls) > 0 || len(GotifyUrl) > 0 {
+		filters := StarFilter{MinTier: PushMinTier}
+		notifier, err := NewPushNotifier(NtfyTopicUrls, NtfyToken, GotifyUrl, GotifyToken, filters)
+		if err != nil {
+			log.Println("Failed to create push notifier")
+			panic(err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if len(MqttBrokerUrl) > 0 {
+		notifier, err := NewMqttNotifier(MqttBrokerUrl, MqttTopicPrefix, MqttClientId, MqttUsername, MqttPassword, database)
+		if err != nil {
+			log.Println("Failed to create MQTT notifier")
+			panic(err)
+		}
+		notifiers = append(notifiers, notifier)
+	}
+	if len(HttpListenAddress) > 0 {
+		stream := NewStreamNotifier()
+		feed := NewFeedNotifier(database, FeedSize, FeedBaseUrl)
+		calendar := NewCalendarNotifier()
+		StartServer(HttpListenAddress, map[string]http.Handler{
+			"GET /events":     stream,
+			"GET /feed.atom":  feed,
+			"GET /stars.ics":  calendar,
+			"GET /map/{file}": http.HandlerFunc(ServeThumbnail),
+		})
+		notifiers = append(notifiers, stream, feed, calendar)
+	}
+	return notifiers
+}
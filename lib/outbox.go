@@ -0,0 +1,301 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"star-notifier/lib/db"
+	"strconv"
+	"strings"
+)
+
+const (
+	OutboxListing  = "listing"
+	OutboxNewStars = "new_stars"
+	OutboxDelete   = "delete"
+)
+
+// DiscordError is returned for requests Discord answered with an unexpected
+// status.
+type DiscordError struct {
+	StatusCode int
+	Body       string
+}
+
+func (err *DiscordError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", err.StatusCode, err.Body)
+}
+
+// isPermanentFailure tells whether retrying the request can not succeed, as
+// Discord rejected it with a client error other than a rate limit.
+func isPermanentFailure(err error) bool {
+	var discordError *DiscordError
+	if !errors.As(err, &discordError) {
+		return false
+	}
+	return discordError.StatusCode >= 400 && discordError.StatusCode < 500 &&
+		discordError.StatusCode != http.StatusTooManyRequests
+}
+
+func newListingEntry(webhook *Webhook, stars *[]*Star, timestamp int64) db.OutboxEntry {
+	return db.OutboxEntry{
+		// one listing entry per webhook, a newer listing replaces a pending one
+		Id:               OutboxListing + "|" + webhook.Url,
+		WebhookUrl:       webhook.Url,
+		Kind:             OutboxListing,
+		Stars:            toStarRecords(stars),
+		CreatedTimestamp: timestamp,
+	}
+}
+
+func newNewStarsEntry(webhook *Webhook, stars *[]*Star, roleIds []string, timestamp int64) db.OutboxEntry {
+	var keys []string
+	for _, star := range *stars {
+		keys = append(keys, star.Key())
+	}
+	return db.OutboxEntry{
+		Id:               strings.Join([]string{OutboxNewStars, webhook.Url, strconv.FormatInt(timestamp, 10), strings.Join(keys, ",")}, "|"),
+		WebhookUrl:       webhook.Url,
+		Kind:             OutboxNewStars,
+		Stars:            toStarRecords(stars),
+		RoleIds:          roleIds,
+		CreatedTimestamp: timestamp,
+	}
+}
+
+func newDeleteEntry(message *db.NewStarMessage, timestamp int64) db.OutboxEntry {
+	return db.OutboxEntry{
+		Id:               OutboxDelete + "|" + message.WebhookUrl + "|" + message.MessageId,
+		WebhookUrl:       message.WebhookUrl,
+		Kind:             OutboxDelete,
+		MessageId:        message.MessageId,
+		ThreadId:         message.ThreadId,
+		CreatedTimestamp: timestamp,
+	}
+}
+
+// enqueue adds the entry to the outbox. Replacing a pending entry keeps its
+// backoff, so a failing webhook is not retried on every listing update.
+func (notifier *DiscordNotifier) enqueue(entry db.OutboxEntry) {
+	for _, pending := range notifier.database.GetOutboxEntries(entry.WebhookUrl) {
+		if pending.Id == entry.Id {
+			entry.Attempts = pending.Attempts
+			entry.NextAttemptTimestamp = pending.NextAttemptTimestamp
+		}
+	}
+	notifier.database.SetOutboxEntry(entry)
+	notifier.database.SaveUnsafe()
+}
+
+// processOutbox delivers the due outbox entries of a webhook in order. Failed
+// entries are retried later with backoff, holding back the entries after
+// them, until they expire after OUTBOX_MAX_AGE.
+func (notifier *DiscordNotifier) processOutbox(ctx context.Context, webhook *Webhook, timestamp int64) {
+	database := notifier.database
+	for _, entry := range database.GetOutboxEntries(webhook.Url) {
+		if timestamp-entry.CreatedTimestamp > int64(OutboxMaxAge) {
+			log.Printf("Dropping expired %s operation to %s after %d attempt(s)\n", entry.Kind, webhook.Url, entry.Attempts)
+			notifier.removeEntry(entry)
+			continue
+		}
+		if entry.NextAttemptTimestamp > timestamp {
+			return
+		}
+
+		err := notifier.deliverEntry(ctx, webhook, entry, timestamp)
+		if err == nil {
+			notifier.removeEntry(entry)
+			continue
+		}
+		if isPermanentFailure(err) {
+			log.Printf("Dropping %s operation to %s: %v\n", entry.Kind, webhook.Url, err)
+			notifier.removeEntry(entry)
+			continue
+		}
+
+		entry.Attempts++
+		entry.NextAttemptTimestamp = timestamp + outboxBackoff(entry.Attempts)
+		log.Printf("Failed %s operation to %s (attempt %d), retrying in %ds: %v\n",
+			entry.Kind, webhook.Url, entry.Attempts, entry.NextAttemptTimestamp-timestamp, err)
+		database.SetOutboxEntry(entry)
+		database.SaveUnsafe()
+		return
+	}
+}
+
+func (notifier *DiscordNotifier) removeEntry(entry db.OutboxEntry) {
+	notifier.database.RemoveOutboxEntries(func(stored db.OutboxEntry) bool {
+		return stored.Id == entry.Id
+	})
+	notifier.database.SaveUnsafe()
+}
+
+func (notifier *DiscordNotifier) deliverEntry(ctx context.Context, webhook *Webhook, entry db.OutboxEntry, timestamp int64) error {
+	database := notifier.database
+	switch entry.Kind {
+	case OutboxListing:
+		messages, err := createListingMessages(restoreStars(entry.Stars, timestamp), webhook)
+		if err != nil {
+			return fmt.Errorf("failed to create listing messages: %w", err)
+		}
+		return deliverListingMessages(ctx, messages, webhook, database)
+	case OutboxNewStars:
+		stars := restoreStars(entry.Stars, timestamp)
+		if len(*stars) == 0 {
+			log.Println("Dropping new star message to", webhook.Url, "-- the stars have depleted")
+			return nil
+		}
+		// forum posts are kept, deleting their first message would leave
+		// an empty post behind
+		temporary := !webhook.IsForum() && !entry.Retained
+		message, err := createNewStarMessage(stars, entry.RoleIds, webhook, temporary)
+		if err != nil {
+			return fmt.Errorf("failed to create new star message: %w", err)
+		}
+		threadId := webhook.ThreadId
+		if webhook.IsForum() {
+			message.ThreadName = webhook.FormatThreadName((*stars)[0])
+		}
+		messageId, _, err := postMessage(ctx, webhook.Url, threadId, message)
+		if err != nil {
+			return err
+		}
+		if temporary {
+			database.AddThreadNewStarMessage(webhook.Url, threadId, messageId, timestamp)
+		}
+		database.SaveUnsafe()
+		return nil
+	case OutboxDelete:
+		err := deleteMessage(ctx, webhook.Url, entry.ThreadId, entry.MessageId)
+		var discordError *DiscordError
+		if errors.As(err, &discordError) && discordError.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown outbox operation '%s'", entry.Kind)
+}
+
+// deliverListingMessages edits the stored listing pages in order and posts
+// the pages that do not exist yet. Pages no longer needed are deleted. When a
+// page was deleted by someone else, the following pages are reposted so that
+// the pages stay in order. Forum webhooks keep the listing in its own post,
+// other webhooks repost the listing when their thread changes.
+func deliverListingMessages(ctx context.Context, messages []*DiscordMessage, webhook *Webhook, database *db.Database) error {
+	webhookUrl := webhook.Url
+	threadId := webhook.ThreadId
+	postedThreadId, known := database.GetListingThread(webhookUrl)
+	if webhook.IsForum() {
+		threadId = postedThreadId
+	}
+	messageIds := database.GetListingMessages(webhookUrl)
+	if !webhook.IsForum() {
+		if known && postedThreadId != threadId && len(messageIds) > 0 {
+			log.Println("Listing thread changed for url", webhookUrl, "-- posting new listing messages")
+			if err := deleteListingMessages(ctx, webhookUrl, postedThreadId, messageIds); err != nil {
+				log.Println("Failed to remove old listing messages from", webhookUrl, err)
+			}
+			messageIds = nil
+		}
+		database.SetListingThread(webhookUrl, threadId)
+	}
+	if len(messageIds) == 0 {
+		log.Println("Listing message does not exist for url", webhookUrl, "-- posting new message...")
+	}
+
+	var pageIds []string
+	for index, message := range messages {
+		if index < len(messageIds) {
+			statusCode, err := editMessage(ctx, webhookUrl, threadId, messageIds[index], message)
+			if err == nil {
+				pageIds = append(pageIds, messageIds[index])
+				continue
+			}
+			if statusCode != http.StatusNotFound {
+				database.SetListingMessages(webhookUrl, append(pageIds, messageIds[index:]...))
+				database.SaveUnsafe()
+				return err
+			}
+			log.Println("Failed to edit listing message to", webhookUrl, "-- posting new listing messages")
+			log.Println(err)
+			if err = deleteListingMessages(ctx, webhookUrl, threadId, messageIds[index+1:]); err != nil {
+				log.Println("Failed to remove old listing messages from", webhookUrl, err)
+			}
+			messageIds = messageIds[:index]
+		}
+
+		if webhook.IsForum() && len(threadId) == 0 {
+			message.ThreadName = webhook.ListingThread
+		}
+		messageId, channelId, err := postMessage(ctx, webhookUrl, threadId, message)
+		if err != nil {
+			var discordError *DiscordError
+			if webhook.IsForum() && errors.As(err, &discordError) && discordError.StatusCode == http.StatusNotFound {
+				// the listing post was deleted, the next attempt creates a new one
+				log.Println("Listing post no longer exists for", webhookUrl)
+				database.SetListingThread(webhookUrl, "")
+				pageIds = nil
+			}
+			database.SetListingMessages(webhookUrl, pageIds)
+			database.SaveUnsafe()
+			return err
+		}
+		if webhook.IsForum() && len(threadId) == 0 {
+			threadId = channelId
+			database.SetListingThread(webhookUrl, threadId)
+		}
+		pageIds = append(pageIds, messageId)
+	}
+
+	if len(messageIds) > len(messages) {
+		log.Printf("Removing %d surplus listing message(s) from %s\n", len(messageIds)-len(messages), webhookUrl)
+		if err := deleteListingMessages(ctx, webhookUrl, threadId, messageIds[len(messages):]); err != nil {
+			// keep the surplus messages to delete them on the next attempt
+			database.SetListingMessages(webhookUrl, messageIds)
+			database.SaveUnsafe()
+			return err
+		}
+	}
+	database.SetListingMessages(webhookUrl, pageIds)
+	database.SaveUnsafe()
+	return nil
+}
+
+func deleteListingMessages(ctx context.Context, webhookUrl, threadId string, messageIds []string) error {
+	for _, messageId := range messageIds {
+		err := deleteMessage(ctx, webhookUrl, threadId, messageId)
+		var discordError *DiscordError
+		if err != nil && !(errors.As(err, &discordError) && discordError.StatusCode == http.StatusNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func outboxBackoff(attempts int) int64 {
+	return min(int64(15)<<min(attempts-1, 10), 900)
+}
+
+func toStarRecords(stars *[]*Star) []db.StarRecord {
+	var records []db.StarRecord
+	for _, star := range *stars {
+		records = append(records, ToStarRecord(star))
+	}
+	return records
+}
+
+// restoreStars restores stored stars that have not depleted yet.
+func restoreStars(records []db.StarRecord, timestamp int64) *[]*Star {
+	stars := make([]*Star, 0, len(records))
+	for _, record := range records {
+		if record.DepleteTime < timestamp {
+			continue
+		}
+		if star := FromStarRecord(record); star != nil {
+			stars = append(stars, star)
+		}
+	}
+	return &stars
+}
@@ -0,0 +1,166 @@
+package lib
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"star-notifier/lib/db"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// withoutDiscordRetries makes failed Discord requests return right away
+// instead of being retried by the client.
+func withoutDiscordRetries(t *testing.T) {
+	client := discordClient
+	discordClient = NewDiscordClient(0)
+	t.Cleanup(func() {
+		discordClient = client
+	})
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	for _, test := range []struct {
+		attempts int
+		backoff  int64
+	}{
+		{1, 15},
+		{2, 30},
+		{5, 240},
+		{7, 900},
+		{50, 900},
+	} {
+		if backoff := outboxBackoff(test.attempts); backoff != test.backoff {
+			t.Errorf("backoff after %d attempt(s) is %d, expected %d", test.attempts, backoff, test.backoff)
+		}
+	}
+}
+
+func TestProcessOutbox(t *testing.T) {
+	withoutDiscordRetries(t)
+	const timestamp = int64(1_000_000)
+	const messagesPath = "/api/webhooks/1/token/messages/"
+
+	for _, test := range []struct {
+		name string
+		// the status of deleting each message, OK by default
+		status    map[string]int
+		created   map[string]int64
+		deleted   []string
+		remaining []string
+		attempts  int
+	}{
+		{
+			name:    "entries are delivered in order",
+			deleted: []string{"1", "2", "3"},
+		},
+		{
+			name:      "failed entries hold back the entries after them",
+			status:    map[string]int{"2": http.StatusInternalServerError},
+			deleted:   []string{"1", "2"},
+			remaining: []string{"2", "3"},
+			attempts:  1,
+		},
+		{
+			name:    "permanently failed entries are dropped",
+			status:  map[string]int{"2": http.StatusForbidden},
+			deleted: []string{"1", "2", "3"},
+		},
+		{
+			name:    "deleting a deleted message succeeds",
+			status:  map[string]int{"1": http.StatusNotFound},
+			deleted: []string{"1", "2", "3"},
+		},
+		{
+			name:    "expired entries are dropped",
+			created: map[string]int64{"1": timestamp - int64(OutboxMaxAge) - 1},
+			deleted: []string{"2", "3"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeDiscordServer(t)
+			server.status = func(request discordRequest) int {
+				if status, ok := test.status[strings.TrimPrefix(request.Path, messagesPath)]; ok {
+					return status
+				}
+				return http.StatusOK
+			}
+			webhook := &Webhook{Url: server.URL + "/api/webhooks/1/token"}
+			database := newTestDatabase(t)
+			notifier := NewDiscordNotifier([]*Webhook{webhook}, database)
+			for _, messageId := range []string{"1", "2", "3"} {
+				created, ok := test.created[messageId]
+				if !ok {
+					created = timestamp
+				}
+				notifier.enqueue(newDeleteEntry(&db.NewStarMessage{WebhookUrl: webhook.Url, MessageId: messageId}, created))
+			}
+
+			notifier.processOutbox(context.Background(), webhook, timestamp)
+
+			var deleted []string
+			for _, request := range server.take() {
+				deleted = append(deleted, strings.TrimPrefix(request.Path, messagesPath))
+			}
+			if !slices.Equal(deleted, test.deleted) {
+				t.Errorf("deleted messages %v, expected %v", deleted, test.deleted)
+			}
+			var remaining []string
+			entries := database.GetOutboxEntries(webhook.Url)
+			for _, entry := range entries {
+				remaining = append(remaining, entry.MessageId)
+			}
+			if !slices.Equal(remaining, test.remaining) {
+				t.Fatalf("remaining entries %v, expected %v", remaining, test.remaining)
+			}
+			if len(entries) > 0 {
+				if entries[0].Attempts != test.attempts || entries[0].NextAttemptTimestamp != timestamp+outboxBackoff(test.attempts) {
+					t.Errorf("unexpected backoff of the failed entry: %+v", entries[0])
+				}
+			}
+		})
+	}
+}
+
+func TestProcessOutboxRetriesAfterBackoff(t *testing.T) {
+	withoutDiscordRetries(t)
+	const timestamp = int64(1_000_000)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	server := newFakeDiscordServer(t)
+	server.status = func(request discordRequest) int {
+		if failing.Load() {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	}
+	webhook := &Webhook{Url: server.URL + "/api/webhooks/1/token"}
+	database := newTestDatabase(t)
+	notifier := NewDiscordNotifier([]*Webhook{webhook}, database)
+	for _, messageId := range []string{"1", "2"} {
+		notifier.enqueue(newDeleteEntry(&db.NewStarMessage{WebhookUrl: webhook.Url, MessageId: messageId}, timestamp))
+	}
+
+	notifier.processOutbox(context.Background(), webhook, timestamp)
+	if requests := server.take(); len(requests) != 1 {
+		t.Fatalf("expected a single failed request, got %+v", requests)
+	}
+
+	// requeuing the entry keeps its backoff
+	notifier.enqueue(newDeleteEntry(&db.NewStarMessage{WebhookUrl: webhook.Url, MessageId: "1"}, timestamp))
+	failing.Store(false)
+	notifier.processOutbox(context.Background(), webhook, timestamp+outboxBackoff(1)-1)
+	if requests := server.take(); len(requests) != 0 {
+		t.Fatalf("entry was retried before its backoff: %+v", requests)
+	}
+
+	notifier.processOutbox(context.Background(), webhook, timestamp+outboxBackoff(1))
+	if requests := server.take(); len(requests) != 2 {
+		t.Fatalf("expected both entries to be delivered after the backoff, got %+v", requests)
+	}
+	if entries := database.GetOutboxEntries(webhook.Url); len(entries) != 0 {
+		t.Errorf("delivered entries are still queued: %+v", entries)
+	}
+}
@@ -0,0 +1,168 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type gotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+// PushNotifier sends a push notification per new star to ntfy topics and
+// Gotify servers. ntfy notifications carry the map thumbnail as an
+// attachment, Gotify only supports linking to the map.
+type PushNotifier struct {
+	ntfyTopicUrls []string
+	ntfyToken     string
+	gotifyUrl     string
+	gotifyToken   string
+	filters       StarFilter
+}
+
+func NewPushNotifier(ntfyTopicUrls []string, ntfyToken, gotifyUrl, gotifyToken string, filters StarFilter) (*PushNotifier, error) {
+	// Gotify rejects messages without an application token
+	if len(gotifyUrl) > 0 && len(gotifyToken) == 0 {
+		return nil, fmt.Errorf("GOTIFY_TOKEN is required with GOTIFY_URL")
+	}
+	return &PushNotifier{
+		ntfyTopicUrls: ntfyTopicUrls,
+		ntfyToken:     ntfyToken,
+		gotifyUrl:     strings.TrimSuffix(gotifyUrl, "/"),
+		gotifyToken:   gotifyToken,
+		filters:       filters,
+	}, nil
+}
+
+func (notifier *PushNotifier) Name() string {
+	return "push"
+}
+
+func (notifier *PushNotifier) PostListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *PushNotifier) UpdateListing(stars *[]*Star) error {
+	return nil
+}
+
+func (notifier *PushNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	var failed int
+	for _, star := range *notifier.filters.Apply(stars) {
+		for _, topicUrl := range notifier.ntfyTopicUrls {
+			if err := notifier.publishNtfy(topicUrl, star, timestamp); err != nil {
+				log.Println("Failed to publish star to ntfy topic", topicUrl, err)
+				failed++
+			}
+		}
+		if len(notifier.gotifyUrl) > 0 {
+			if err := notifier.publishGotify(star, timestamp); err != nil {
+				log.Println("Failed to publish star to Gotify", err)
+				failed++
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to send %d push notification(s)", failed)
+	}
+	return nil
+}
+
+func (notifier *PushNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+func (notifier *PushNotifier) publishNtfy(topicUrl string, star *Star, timestamp int64) error {
+	message := formatPlainStarLine(star, timestamp)
+
+	var body io.Reader = strings.NewReader(message)
+	var thumbnail []byte
+	if star.MappedLocation != nil {
+		var err error
+		thumbnail, err = GetThumbnail(star.MappedLocation.X, star.MappedLocation.Y, MapWidth, MapHeight)
+		if err != nil {
+			log.Println("Failed to create ntfy thumbnail:", err)
+		}
+	}
+	method := http.MethodPost
+	if thumbnail != nil {
+		// attachments are sent as the request body, the message moves to a header
+		method = http.MethodPut
+		body = bytes.NewReader(thumbnail)
+	}
+
+	req, err := http.NewRequest(method, topicUrl, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Title", encodeHeader(formatStarTitle(star)))
+	req.Header.Set("Priority", strconv.Itoa(ntfyPriority(star.Tier)))
+	req.Header.Set("Tags", "star")
+	req.Header.Set("Click", MapUrl(star.MappedLocation))
+	if thumbnail != nil {
+		req.Header.Set("Message", encodeHeader(message))
+		req.Header.Set("Filename", fmt.Sprintf("map%d_%d.png", star.MappedLocation.X, star.MappedLocation.Y))
+	}
+	if len(notifier.ntfyToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+notifier.ntfyToken)
+	}
+	_, err = doRequest(req, nil)
+	return err
+}
+
+func (notifier *PushNotifier) publishGotify(star *Star, timestamp int64) error {
+	mapUrl := MapUrl(star.MappedLocation)
+	message := &gotifyMessage{
+		Title:    formatStarTitle(star),
+		Message:  fmt.Sprintf("%s\n\n[Map](%s) · [Wiki](%s)", formatPlainStarLine(star, timestamp), mapUrl, WikiUrl),
+		Priority: gotifyPriority(star.Tier),
+		Extras: map[string]any{
+			"client::display": map[string]string{
+				"contentType": "text/markdown",
+			},
+			"client::notification": map[string]any{
+				"click": map[string]string{
+					"url": mapUrl,
+				},
+			},
+		},
+	}
+	headers := map[string]string{
+		"X-Gotify-Key": notifier.gotifyToken,
+	}
+	_, err := sendJson(http.MethodPost, notifier.gotifyUrl+"/message", headers, message, nil)
+	return err
+}
+
+// ntfyPriority maps tiers 1-9 to ntfy priorities 2 (low) to 5 (urgent).
+func ntfyPriority(tier int) int {
+	switch {
+	case tier >= 8:
+		return 5
+	case tier >= 6:
+		return 4
+	case tier >= 4:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// gotifyPriority maps tiers 1-9 to Gotify priorities, where 8 and above
+// override do-not-disturb on Android.
+func gotifyPriority(tier int) int {
+	return min(max(tier, 1), 10)
+}
+
+func encodeHeader(value string) string {
+	return mime.QEncoding.Encode("utf-8", value)
+}
@@ -0,0 +1,134 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type ntfyRequest struct {
+	method string
+	header http.Header
+	body   string
+}
+
+func TestPushNotifierNtfy(t *testing.T) {
+	location := &StarLocation{Name: "Aldarin", X: 1000, Y: 2000}
+	thumbnailCacheLock.Lock()
+	thumbnailCache[fmt.Sprintf("%d_%d_%dx%d", location.X, location.Y, MapWidth, MapHeight)] = []byte("png")
+	thumbnailCacheLock.Unlock()
+
+	for _, test := range []struct {
+		name     string
+		location *StarLocation
+		method   string
+		body     string
+		click    string
+		filename string
+	}{
+		{"without thumbnail", nil, http.MethodPost, "[World 330, tier 8] Aldarin", WikiUrl, ""},
+		{"with thumbnail", location, http.MethodPut, "png", MapUrl(location), "map1000_2000.png"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			requests := make(chan ntfyRequest, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+				body, _ := io.ReadAll(request.Body)
+				requests <- ntfyRequest{method: request.Method, header: request.Header, body: string(body)}
+			}))
+			defer server.Close()
+			notifier, err := NewPushNotifier([]string{server.URL + "/stars"}, "token", "", "", StarFilter{})
+			if err != nil {
+				t.Fatalf("NewPushNotifier failed: %v", err)
+			}
+
+			stars := testStars()
+			(*stars)[0].MappedLocation = test.location
+			if err = notifier.AnnounceNewStars(stars, time.Now().Unix()); err != nil {
+				t.Fatalf("AnnounceNewStars failed: %v", err)
+			}
+			request := <-requests
+
+			if request.method != test.method || !strings.HasPrefix(request.body, test.body) {
+				t.Errorf("unexpected %s request with body %q", request.method, request.body)
+			}
+			title, _ := new(mime.WordDecoder).DecodeHeader(request.header.Get("Title"))
+			if title != "T8 star w330 Aldarin" || request.header.Get("Priority") != "5" || request.header.Get("Tags") != "star" {
+				t.Errorf("unexpected headers %v", request.header)
+			}
+			if request.header.Get("Click") != test.click || request.header.Get("Filename") != test.filename {
+				t.Errorf("unexpected click %q and filename %q", request.header.Get("Click"), request.header.Get("Filename"))
+			}
+			message, _ := new(mime.WordDecoder).DecodeHeader(request.header.Get("Message"))
+			if (len(test.filename) > 0) != strings.HasPrefix(message, "[World 330, tier 8] Aldarin") {
+				t.Errorf("unexpected message header %q", message)
+			}
+			if request.header.Get("Authorization") != "Bearer token" {
+				t.Errorf("unexpected authorization header %q", request.header.Get("Authorization"))
+			}
+		})
+	}
+}
+
+func TestPushNotifierGotify(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return map[string]any{"id": 1}
+	})
+	notifier, err := NewPushNotifier(nil, "", server.URL+"/", "app-token", StarFilter{})
+	if err != nil {
+		t.Fatalf("NewPushNotifier failed: %v", err)
+	}
+
+	if err = notifier.AnnounceNewStars(testStars(), time.Now().Unix()); err != nil {
+		t.Fatalf("AnnounceNewStars failed: %v", err)
+	}
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Method != http.MethodPost || requests[0].Path != "/message" {
+		t.Fatalf("unexpected requests %+v", requests)
+	}
+	if requests[0].Header.Get("X-Gotify-Key") != "app-token" {
+		t.Errorf("unexpected token header %q", requests[0].Header.Get("X-Gotify-Key"))
+	}
+	body := requests[0].Body
+	if body["title"] != "T8 star w330 Aldarin" || body["priority"] != float64(8) ||
+		!strings.Contains(body["message"].(string), "[Wiki]("+WikiUrl+")") {
+		t.Errorf("unexpected message %+v", body)
+	}
+	extras, _ := body["extras"].(map[string]any)
+	notification, _ := extras["client::notification"].(map[string]any)
+	click, _ := notification["click"].(map[string]any)
+	if click["url"] != WikiUrl {
+		t.Errorf("unexpected click extras %+v", extras)
+	}
+}
+
+func TestNewPushNotifierRequiresGotifyToken(t *testing.T) {
+	if _, err := NewPushNotifier(nil, "", "https://gotify.example.org", "", StarFilter{}); err == nil {
+		t.Error("expected an error for Gotify without a token")
+	}
+}
+
+func TestPushPriorities(t *testing.T) {
+	for _, test := range []struct {
+		tier, ntfy, gotify int
+	}{
+		{0, 2, 1},
+		{1, 2, 1},
+		{4, 3, 4},
+		{6, 4, 6},
+		{8, 5, 8},
+		{9, 5, 9},
+		{12, 5, 10},
+	} {
+		if priority := ntfyPriority(test.tier); priority != test.ntfy {
+			t.Errorf("ntfy priority of tier %d is %d, expected %d", test.tier, priority, test.ntfy)
+		}
+		if priority := gotifyPriority(test.tier); priority != test.gotify {
+			t.Errorf("Gotify priority of tier %d is %d, expected %d", test.tier, priority, test.gotify)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// StartServer serves the given routes in the background.
+func StartServer(address string, routes map[string]http.Handler) {
+	mux := http.NewServeMux()
+	for pattern, handler := range routes {
+		mux.Handle(pattern, handler)
+	}
+
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		log.Println("Starting http server on", address)
+		if err := server.ListenAndServe(); err != nil {
+			log.Println("Http server stopped:", err)
+		}
+	}()
+}
+
+// ServeThumbnail serves map thumbnails of catalog locations as
+// /map/<x>_<y>.png. Other coordinates are not rendered.
+func ServeThumbnail(writer http.ResponseWriter, request *http.Request) {
+	var x, y int
+	if _, err := fmt.Sscanf(request.PathValue("file"), "%d_%d.png", &x, &y); err != nil {
+		http.NotFound(writer, request)
+		return
+	}
+
+	found := false
+	for _, location := range StarLocations {
+		if location.X == x && location.Y == y {
+			found = true
+			break
+		}
+	}
+	if !found {
+		http.NotFound(writer, request)
+		return
+	}
+
+	thumbnail, err := GetThumbnail(x, y, MapWidth, MapHeight)
+	if err != nil {
+		log.Println("Failed to create thumbnail:", err)
+		http.Error(writer, "failed to create thumbnail", http.StatusInternalServerError)
+		return
+	}
+	writer.Header().Set("Content-Type", "image/png")
+	writer.Header().Set("Content-Length", strconv.Itoa(len(thumbnail)))
+	writer.Header().Set("Cache-Control", "public, max-age=86400")
+	_, _ = writer.Write(thumbnail)
+}
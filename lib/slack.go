@@ -0,0 +1,263 @@
+package lib
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"star-notifier/lib/db"
+	"strings"
+	"time"
+)
+
+const slackMaxBlocks = 50
+
+type SlackMessage struct {
+	Channel string       `json:"channel,omitempty"`
+	Ts      string       `json:"ts,omitempty"`
+	Text    string       `json:"text"`
+	Blocks  []SlackBlock `json:"blocks,omitempty"`
+}
+
+type SlackBlock struct {
+	Type   string       `json:"type"`
+	Text   *SlackText   `json:"text,omitempty"`
+	Fields []*SlackText `json:"fields,omitempty"`
+}
+
+type SlackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackResponse struct {
+	Ok      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	Ts      string `json:"ts"`
+}
+
+// SlackNotifier announces new stars through incoming webhooks. With a bot
+// token it also keeps a listing message per channel up to date, and posts
+// announcements to those channels when no incoming webhooks are configured.
+type SlackNotifier struct {
+	apiUrl      string
+	token       string
+	webhookUrls []string
+	channels    []string
+	database    *db.Database
+}
+
+func NewSlackNotifier(apiUrl, token string, webhookUrls, channels []string, database *db.Database) *SlackNotifier {
+	return &SlackNotifier{
+		apiUrl:      strings.TrimSuffix(apiUrl, "/"),
+		token:       token,
+		webhookUrls: webhookUrls,
+		channels:    channels,
+		database:    database,
+	}
+}
+
+func (notifier *SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (notifier *SlackNotifier) PostListing(stars *[]*Star) error {
+	if len(notifier.token) == 0 {
+		return nil
+	}
+	message := createSlackListingMessage(stars)
+	for _, channel := range notifier.channels {
+		notifier.postListingMessage(channel, message)
+	}
+	return nil
+}
+
+func (notifier *SlackNotifier) UpdateListing(stars *[]*Star) error {
+	if len(notifier.token) == 0 {
+		return nil
+	}
+	message := createSlackListingMessage(stars)
+	for _, channel := range notifier.channels {
+		ts := notifier.database.GetListingMessage(slackKey(channel))
+		if ts == nil || len(*ts) == 0 {
+			log.Println("Slack listing message does not exist for", channel, "-- posting new message...")
+			notifier.postListingMessage(channel, message)
+			continue
+		}
+
+		message.Channel = channel
+		message.Ts = *ts
+		if _, err := notifier.callApi("chat.update", message); err != nil {
+			if strings.Contains(err.Error(), "message_not_found") {
+				log.Println("Slack listing message is gone from", channel, "-- posting new listing message")
+				notifier.postListingMessage(channel, message)
+			} else {
+				log.Println("Failed to update Slack listing message in", channel, "--", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (notifier *SlackNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	messages := createSlackNewStarMessages(stars)
+	for _, url := range notifier.webhookUrls {
+		for _, message := range messages {
+			if _, err := sendJson(http.MethodPost, url, nil, message, nil); err != nil {
+				log.Println("Failed to post new stars to Slack webhook:", err)
+			}
+		}
+	}
+	if len(notifier.webhookUrls) > 0 || len(notifier.token) == 0 {
+		return nil
+	}
+
+	for _, channel := range notifier.channels {
+		for _, message := range messages {
+			message.Channel = channel
+			message.Ts = ""
+			response, err := notifier.callApi("chat.postMessage", message)
+			if err != nil {
+				log.Println("Failed to post new stars to Slack channel", channel, err)
+				continue
+			}
+			notifier.database.AddNewStarMessage(slackKey(channel), response.Ts, timestamp)
+			notifier.database.SaveUnsafe()
+		}
+	}
+	return nil
+}
+
+func (notifier *SlackNotifier) RetractMessages(timestamp int64) error {
+	if len(notifier.token) == 0 {
+		return nil
+	}
+	for _, channel := range notifier.channels {
+		oldMessages := notifier.database.GetOldNewStarMessages(slackKey(channel), NewStarMessageMaxAge)
+		if len(*oldMessages) == 0 {
+			continue
+		}
+		for _, message := range *oldMessages {
+			if _, err := notifier.callApi("chat.delete", SlackMessage{Channel: channel, Ts: message.MessageId}); err != nil {
+				log.Printf("Failed to delete Slack message %s from %s: %v\n", message.MessageId, channel, err)
+			}
+		}
+		notifier.database.RemoveNewStarMessages(oldMessages)
+		notifier.database.SaveUnsafe()
+	}
+	return nil
+}
+
+func (notifier *SlackNotifier) postListingMessage(channel string, message *SlackMessage) {
+	message.Channel = channel
+	message.Ts = ""
+	response, err := notifier.callApi("chat.postMessage", message)
+	if err != nil {
+		log.Println("Failed to post Slack listing message to", channel, err)
+		return
+	}
+	notifier.database.SetListingMessage(slackKey(channel), response.Ts)
+	notifier.database.SaveUnsafe()
+}
+
+func (notifier *SlackNotifier) callApi(method string, payload any) (*slackResponse, error) {
+	var response slackResponse
+	headers := map[string]string{
+		"Authorization": "Bearer " + notifier.token,
+	}
+	_, err := sendJson(http.MethodPost, notifier.apiUrl+"/"+method, headers, payload, &response)
+	if err != nil {
+		return nil, err
+	}
+	if !response.Ok {
+		return nil, fmt.Errorf("%s failed: %s", method, response.Error)
+	}
+	return &response, nil
+}
+
+func slackKey(channel string) string {
+	return "slack:" + channel
+}
+
+// createSlackNewStarMessages creates the messages announcing new stars, with a
+// section for every star. Slack allows at most 50 blocks in a message, so
+// further stars continue in another message.
+func createSlackNewStarMessages(stars *[]*Star) []*SlackMessage {
+	stars = sortedStars(stars)
+	var messages []*SlackMessage
+	for start := 0; start < len(*stars); start += slackMaxBlocks - 1 {
+		messages = append(messages, createSlackNewStarMessage((*stars)[start:min(start+slackMaxBlocks-1, len(*stars))]))
+	}
+	return messages
+}
+
+func createSlackNewStarMessage(stars []*Star) *SlackMessage {
+	message := &SlackMessage{
+		Blocks: []SlackBlock{
+			{Type: "header", Text: &SlackText{Type: "plain_text", Text: "New shooting stars"}},
+		},
+	}
+
+	var summaries []string
+	for _, star := range stars {
+		summaries = append(summaries, formatStarTitle(star))
+		message.Blocks = append(message.Blocks, SlackBlock{
+			Type: "section",
+			Fields: []*SlackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Tier*\n%d", star.Tier)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*World*\n%d", star.World)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Location*\n%s", star.CalledLocation)},
+				{Type: "mrkdwn", Text: fmt.Sprintf("*Est. depletion*\n%s", formatSlackTime(star.DepleteTime))},
+			},
+		})
+	}
+	message.Text = "New stars: " + strings.Join(summaries, ", ")
+	return message
+}
+
+func createSlackListingMessage(stars *[]*Star) *SlackMessage {
+	stars = sortedStars(stars)
+
+	var lines []string
+	length := 0
+	for _, star := range *stars {
+		line := fmt.Sprintf(
+			"*[World %d, tier %d]* %s (est. depletion: %s)%s",
+			star.World,
+			star.Tier,
+			star.CalledLocation,
+			formatSlackTime(star.DepleteTime),
+			formatHomePointDistance(star),
+		)
+		// section text is limited to 3000 characters
+		if length+len(line)+1 > 3000 {
+			break
+		}
+		length += len(line) + 1
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "No stars at the moment :(")
+	}
+
+	content := strings.Join(lines, "\n")
+	return &SlackMessage{
+		Text: content,
+		Blocks: []SlackBlock{
+			{Type: "section", Text: &SlackText{Type: "mrkdwn", Text: content}},
+		},
+	}
+}
+
+// formatSlackTime renders a timestamp relative to the reader's clock, falling
+// back to UTC time for clients that do not support date formatting.
+func formatSlackTime(timestamp int64) string {
+	fallback := time.Unix(timestamp, 0).UTC().Format("15:04 UTC")
+	return fmt.Sprintf("<!date^%d^{ago}|%s>", timestamp, fallback)
+}
+
+// formatStarTitle formats a short platform independent summary of a star,
+// e.g. "T8 star w330 Aldarin".
+func formatStarTitle(star *Star) string {
+	return fmt.Sprintf("T%d star w%d %s", star.Tier, star.World, star.CalledLocation)
+}
@@ -0,0 +1,193 @@
+package lib
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"star-notifier/lib/db"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   map[string]any
+}
+
+// recordingServer answers every request with the response of the handler and
+// records the requests it received.
+type recordingServer struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []recordedRequest
+}
+
+func newRecordingServer(t *testing.T, handler func(request recordedRequest) any) *recordingServer {
+	server := &recordingServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		recorded := recordedRequest{Method: request.Method, Path: request.URL.Path, Header: request.Header}
+		_ = json.NewDecoder(request.Body).Decode(&recorded.Body)
+		server.lock.Lock()
+		server.requests = append(server.requests, recorded)
+		server.lock.Unlock()
+
+		writer.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(writer).Encode(handler(recorded))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *recordingServer) take() []recordedRequest {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+	requests := server.requests
+	server.requests = nil
+	return requests
+}
+
+func newTestDatabase(t *testing.T) *db.Database {
+	database, err := db.Load(filepath.Join(t.TempDir(), "db.json"))
+	if err != nil {
+		t.Fatalf("failed to load db: %v", err)
+	}
+	return database
+}
+
+func testStars() *[]*Star {
+	now := time.Now().Unix()
+	return &[]*Star{
+		{CalledLocation: "Aldarin", Tier: 8, World: 330, CalledAt: now, DepleteTime: now + 600},
+	}
+}
+
+func TestSlackNotifierListing(t *testing.T) {
+	messageFound := true
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		if request.Path == "/chat.update" && !messageFound {
+			return slackResponse{Ok: false, Error: "message_not_found"}
+		}
+		return slackResponse{Ok: true, Channel: "C1", Ts: "1.0" + request.Path}
+	})
+	database := newTestDatabase(t)
+	notifier := NewSlackNotifier(server.URL+"/", "token", nil, []string{"C1"}, database)
+
+	if err := notifier.PostListing(testStars()); err != nil {
+		t.Fatalf("PostListing failed: %v", err)
+	}
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Path != "/chat.postMessage" || requests[0].Body["channel"] != "C1" {
+		t.Fatalf("unexpected requests for posting the listing: %+v", requests)
+	}
+	if requests[0].Header.Get("Authorization") != "Bearer token" {
+		t.Errorf("unexpected authorization header %q", requests[0].Header.Get("Authorization"))
+	}
+	if ts := database.GetListingMessage(slackKey("C1")); ts == nil || *ts != "1.0/chat.postMessage" {
+		t.Fatalf("listing message was not stored: %v", ts)
+	}
+
+	if err := notifier.UpdateListing(testStars()); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	requests = server.take()
+	if len(requests) != 1 || requests[0].Path != "/chat.update" || requests[0].Body["ts"] != "1.0/chat.postMessage" {
+		t.Fatalf("unexpected requests for editing the listing: %+v", requests)
+	}
+
+	messageFound = false
+	if err := notifier.UpdateListing(testStars()); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	requests = server.take()
+	if len(requests) != 2 || requests[1].Path != "/chat.postMessage" {
+		t.Fatalf("missing listing message was not reposted: %+v", requests)
+	}
+	if _, ok := requests[1].Body["ts"]; ok {
+		t.Errorf("reposted listing message still has a ts: %+v", requests[1].Body)
+	}
+}
+
+func TestSlackNotifierNewStars(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return slackResponse{Ok: true, Channel: "C1", Ts: "2.0"}
+	})
+	database := newTestDatabase(t)
+	notifier := NewSlackNotifier(server.URL, "token", nil, []string{"C1"}, database)
+
+	postedAt := time.Now().Unix() - int64(NewStarMessageMaxAge) - 1
+	if err := notifier.AnnounceNewStars(testStars(), postedAt); err != nil {
+		t.Fatalf("AnnounceNewStars failed: %v", err)
+	}
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Path != "/chat.postMessage" || requests[0].Body["channel"] != "C1" {
+		t.Fatalf("unexpected requests for posting new stars: %+v", requests)
+	}
+	if text := requests[0].Body["text"]; text != "New stars: T8 star w330 Aldarin" {
+		t.Errorf("unexpected message text %q", text)
+	}
+
+	if err := notifier.RetractMessages(time.Now().Unix()); err != nil {
+		t.Fatalf("RetractMessages failed: %v", err)
+	}
+	requests = server.take()
+	if len(requests) != 1 || requests[0].Path != "/chat.delete" || requests[0].Body["ts"] != "2.0" {
+		t.Fatalf("unexpected requests for retracting new stars: %+v", requests)
+	}
+	if messages := database.GetOldNewStarMessages(slackKey("C1"), 0); len(*messages) != 0 {
+		t.Errorf("retracted messages are still stored: %+v", *messages)
+	}
+}
+
+func TestSlackNotifierIncomingWebhooks(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return nil
+	})
+	notifier := NewSlackNotifier(server.URL, "token", []string{server.URL + "/hook"}, []string{"C1"}, newTestDatabase(t))
+
+	if err := notifier.AnnounceNewStars(testStars(), time.Now().Unix()); err != nil {
+		t.Fatalf("AnnounceNewStars failed: %v", err)
+	}
+	// channels are only posted to without incoming webhooks
+	requests := server.take()
+	if len(requests) != 1 || requests[0].Path != "/hook" {
+		t.Fatalf("unexpected requests for posting new stars: %+v", requests)
+	}
+	if _, ok := requests[0].Body["channel"]; ok {
+		t.Errorf("incoming webhook message has a channel: %+v", requests[0].Body)
+	}
+}
+
+func TestCreateSlackNewStarMessagesLimitsBlocks(t *testing.T) {
+	for _, test := range []struct {
+		stars    int
+		messages int
+	}{
+		{1, 1},
+		{slackMaxBlocks - 1, 1},
+		{slackMaxBlocks, 2},
+		{120, 3},
+	} {
+		var stars []*Star
+		for world := 0; world < test.stars; world++ {
+			stars = append(stars, &Star{CalledLocation: "Aldarin", Tier: 8, World: 300 + world})
+		}
+		messages := createSlackNewStarMessages(&stars)
+		if len(messages) != test.messages {
+			t.Fatalf("%d stars were split into %d messages, expected %d", test.stars, len(messages), test.messages)
+		}
+		sections := 0
+		for _, message := range messages {
+			if len(message.Blocks) > slackMaxBlocks || message.Blocks[0].Type != "header" {
+				t.Errorf("message with %d blocks starting with %q", len(message.Blocks), message.Blocks[0].Type)
+			}
+			sections += len(message.Blocks) - 1
+		}
+		if sections != test.stars {
+			t.Errorf("%d stars have %d sections", test.stars, sections)
+		}
+	}
+}
@@ -5,21 +5,29 @@ import (
 )
 
 type StarLocation struct {
-	X int
-	Y int
+	Name   string
+	Region string
+	X      int
+	Y      int
 }
 
-var StarLocations map[string]StarLocation
+var StarLocations = createStarLocations()
 
 // TODO: load from json?
-func init() {
-	StarLocations = make(map[string]StarLocation)
-	StarLocations["south east mine"] = StarLocation{X: 1745, Y: 2954}
-	StarLocations["hunter guild"] = StarLocation{X: 1487, Y: 3090}
-	StarLocations["colosseum entrance"] = StarLocation{X: 1773, Y: 3102}
-	StarLocations["salvager overlook"] = StarLocation{X: 1627, Y: 3275}
-	StarLocations["aldarin"] = StarLocation{X: 1422, Y: 2874}
-	StarLocations["custodia mountains"] = StarLocation{X: 1290, Y: 3411}
+func createStarLocations() map[string]StarLocation {
+	starLocations := make(map[string]StarLocation)
+	starLocations["south east mine"] = StarLocation{Region: "Varlamore", X: 1745, Y: 2954}
+	starLocations["hunter guild"] = StarLocation{Region: "Varlamore", X: 1487, Y: 3090}
+	starLocations["colosseum entrance"] = StarLocation{Region: "Varlamore", X: 1773, Y: 3102}
+	starLocations["salvager overlook"] = StarLocation{Region: "Varlamore", X: 1627, Y: 3275}
+	starLocations["aldarin"] = StarLocation{Region: "Varlamore", X: 1422, Y: 2874}
+	starLocations["custodia mountains"] = StarLocation{Region: "Varlamore", X: 1290, Y: 3411}
+
+	for trigger, location := range starLocations {
+		location.Name = trigger
+		starLocations[trigger] = location
+	}
+	return starLocations
 }
 
 func GetStarLocation(calledLocation string) *StarLocation {
@@ -0,0 +1,159 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const streamHeartbeatInterval = 30 * time.Second
+
+// StreamNotifier keeps the current star list in memory and streams star
+// events to Server-Sent Events clients as they are detected.
+type StreamNotifier struct {
+	lock        sync.RWMutex
+	stars       *[]*Star
+	subscribers map[chan *StarEvent]bool
+}
+
+func NewStreamNotifier() *StreamNotifier {
+	return &StreamNotifier{
+		subscribers: make(map[chan *StarEvent]bool),
+	}
+}
+
+func (notifier *StreamNotifier) Name() string {
+	return "stream"
+}
+
+func (notifier *StreamNotifier) PostListing(stars *[]*Star) error {
+	return notifier.UpdateListing(stars)
+}
+
+func (notifier *StreamNotifier) UpdateListing(stars *[]*Star) error {
+	notifier.lock.Lock()
+	notifier.stars = stars
+	notifier.lock.Unlock()
+
+	notifier.broadcast(NewSnapshotEvent(stars, time.Now().Unix()))
+	return nil
+}
+
+func (notifier *StreamNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	for _, star := range *stars {
+		notifier.broadcast(NewStarEvent(EventNewStar, star, timestamp))
+	}
+	return nil
+}
+
+func (notifier *StreamNotifier) NotifyChanges(changes *StarChanges, timestamp int64) error {
+	for _, star := range changes.Updated {
+		notifier.broadcast(NewStarEvent(EventTierUpdate, star, timestamp))
+	}
+	for _, star := range changes.Depleted {
+		notifier.broadcast(NewStarEvent(EventDepleted, star, timestamp))
+	}
+	return nil
+}
+
+func (notifier *StreamNotifier) RetractMessages(timestamp int64) error {
+	return nil
+}
+
+// Stars returns the star list of the latest listing update.
+func (notifier *StreamNotifier) Stars() *[]*Star {
+	notifier.lock.RLock()
+	defer notifier.lock.RUnlock()
+	if notifier.stars == nil {
+		return &[]*Star{}
+	}
+	return notifier.stars
+}
+
+func (notifier *StreamNotifier) subscribe() chan *StarEvent {
+	events := make(chan *StarEvent, 32)
+	notifier.lock.Lock()
+	notifier.subscribers[events] = true
+	notifier.lock.Unlock()
+	return events
+}
+
+func (notifier *StreamNotifier) unsubscribe(events chan *StarEvent) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	if notifier.subscribers[events] {
+		delete(notifier.subscribers, events)
+		close(events)
+	}
+}
+
+// broadcast hands the event to every subscriber. Clients that are too slow
+// to keep up are disconnected instead of blocking the main loop.
+func (notifier *StreamNotifier) broadcast(event *StarEvent) {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+	for events := range notifier.subscribers {
+		select {
+		case events <- event:
+		default:
+			log.Println("Dropping slow event stream client")
+			delete(notifier.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+func (notifier *StreamNotifier) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("Access-Control-Allow-Origin", "*")
+
+	events := notifier.subscribe()
+	defer notifier.unsubscribe(events)
+
+	if err := writeStreamEvent(writer, NewSnapshotEvent(notifier.Stars(), time.Now().Unix())); err != nil {
+		return
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := writeStreamEvent(writer, event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(writer http.ResponseWriter, event *StarEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "id: %s\nevent: %s\ndata: %s\n\n", event.Id, event.Type, data)
+	return err
+}
@@ -0,0 +1,367 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"star-notifier/lib/db"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	telegramTextLimit    = 4096
+	telegramCaptionLimit = 1024
+)
+
+type telegramResponse struct {
+	Ok          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+type telegramMessage struct {
+	MessageId int64 `json:"message_id"`
+}
+
+type telegramMedia struct {
+	Type      string `json:"type"`
+	Media     string `json:"media"`
+	Caption   string `json:"caption,omitempty"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// TelegramNotifier sends new stars to chats and keeps one pinned listing
+// message per chat, shown as a photo with the map thumbnail of the first star.
+type TelegramNotifier struct {
+	apiUrl   string
+	token    string
+	chatIds  []string
+	database *db.Database
+}
+
+func NewTelegramNotifier(apiUrl, token string, chatIds []string, database *db.Database) *TelegramNotifier {
+	return &TelegramNotifier{
+		apiUrl:   strings.TrimSuffix(apiUrl, "/"),
+		token:    token,
+		chatIds:  chatIds,
+		database: database,
+	}
+}
+
+func (notifier *TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (notifier *TelegramNotifier) PostListing(stars *[]*Star) error {
+	text, thumbnail := createTelegramListing(stars)
+	for _, chatId := range notifier.chatIds {
+		notifier.postListingMessage(chatId, text, thumbnail)
+	}
+	return nil
+}
+
+func (notifier *TelegramNotifier) UpdateListing(stars *[]*Star) error {
+	text, thumbnail := createTelegramListing(stars)
+	var errs []error
+	for _, chatId := range notifier.chatIds {
+		messageId := notifier.database.GetListingMessage(telegramKey(chatId))
+		if messageId == nil || len(*messageId) == 0 {
+			log.Println("Telegram listing message does not exist for", chatId, "-- posting new message...")
+			notifier.postListingMessage(chatId, text, thumbnail)
+			continue
+		}
+
+		var err error
+		if thumbnail != nil {
+			err = notifier.editMedia(chatId, *messageId, text, thumbnail)
+		} else {
+			_, err = notifier.callApi("editMessageText", map[string]any{
+				"chat_id":    chatId,
+				"message_id": telegramMessageId(*messageId),
+				"text":       text,
+				"parse_mode": "HTML",
+			})
+		}
+		if err == nil || strings.Contains(err.Error(), "message is not modified") {
+			continue
+		}
+		if !isTelegramReplaceError(err) {
+			errs = append(errs, fmt.Errorf("failed to edit listing message in %s: %w", chatId, err))
+			continue
+		}
+
+		log.Println("Failed to edit Telegram listing message in", chatId, "-- replacing listing message:", err)
+		notifier.deleteMessage(chatId, *messageId)
+		notifier.postListingMessage(chatId, text, thumbnail)
+	}
+	return errors.Join(errs...)
+}
+
+// isTelegramReplaceError tells whether the listing message has to be posted
+// again after the edit failed. Either the message was deleted, or it can not
+// be edited as photo and text messages cannot be edited into each other when
+// the map thumbnail comes or goes.
+func isTelegramReplaceError(err error) bool {
+	for _, description := range []string{
+		"message to edit not found",
+		"there is no text in the message to edit",
+		"there is no media in the message to edit",
+	} {
+		if strings.Contains(err.Error(), description) {
+			return true
+		}
+	}
+	return false
+}
+
+func (notifier *TelegramNotifier) AnnounceNewStars(stars *[]*Star, timestamp int64) error {
+	stars = sortedStars(stars)
+	var lines []string
+	for _, star := range *stars {
+		lines = append(lines, "⭐ "+formatTelegramStarLine(star, timestamp))
+	}
+	text := truncateLines(lines, telegramTextLimit)
+
+	for _, chatId := range notifier.chatIds {
+		messageId, err := notifier.sendMessage(chatId, text)
+		if err != nil {
+			log.Println("Failed to post new stars to Telegram chat", chatId, err)
+			continue
+		}
+		notifier.database.AddNewStarMessage(telegramKey(chatId), messageId, timestamp)
+		notifier.database.SaveUnsafe()
+	}
+	return nil
+}
+
+func (notifier *TelegramNotifier) RetractMessages(timestamp int64) error {
+	for _, chatId := range notifier.chatIds {
+		oldMessages := notifier.database.GetOldNewStarMessages(telegramKey(chatId), NewStarMessageMaxAge)
+		if len(*oldMessages) == 0 {
+			continue
+		}
+		for _, message := range *oldMessages {
+			notifier.deleteMessage(chatId, message.MessageId)
+		}
+		notifier.database.RemoveNewStarMessages(oldMessages)
+		notifier.database.SaveUnsafe()
+	}
+	return nil
+}
+
+func (notifier *TelegramNotifier) postListingMessage(chatId, text string, thumbnail []byte) {
+	var messageId string
+	var err error
+	if thumbnail != nil {
+		messageId, err = notifier.sendPhoto(chatId, text, thumbnail)
+	} else {
+		messageId, err = notifier.sendMessage(chatId, text)
+	}
+	if err != nil {
+		log.Println("Failed to post Telegram listing message to", chatId, err)
+		return
+	}
+
+	notifier.database.SetListingMessage(telegramKey(chatId), messageId)
+	notifier.database.SaveUnsafe()
+
+	_, err = notifier.callApi("pinChatMessage", map[string]any{
+		"chat_id":              chatId,
+		"message_id":           telegramMessageId(messageId),
+		"disable_notification": true,
+	})
+	if err != nil {
+		log.Println("Failed to pin Telegram listing message in", chatId, err)
+	}
+}
+
+func (notifier *TelegramNotifier) sendMessage(chatId, text string) (string, error) {
+	result, err := notifier.callApi("sendMessage", map[string]any{
+		"chat_id":    chatId,
+		"text":       text,
+		"parse_mode": "HTML",
+	})
+	if err != nil {
+		return "", err
+	}
+	return parseTelegramMessageId(result)
+}
+
+func (notifier *TelegramNotifier) sendPhoto(chatId, caption string, photo []byte) (string, error) {
+	result, err := notifier.callMultipart("sendPhoto", map[string]string{
+		"chat_id":    chatId,
+		"caption":    caption,
+		"parse_mode": "HTML",
+	}, "photo", photo)
+	if err != nil {
+		return "", err
+	}
+	return parseTelegramMessageId(result)
+}
+
+func (notifier *TelegramNotifier) editMedia(chatId, messageId, caption string, photo []byte) error {
+	media, err := json.Marshal(telegramMedia{
+		Type:      "photo",
+		Media:     "attach://map",
+		Caption:   caption,
+		ParseMode: "HTML",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode media: %w", err)
+	}
+	_, err = notifier.callMultipart("editMessageMedia", map[string]string{
+		"chat_id":    chatId,
+		"message_id": messageId,
+		"media":      string(media),
+	}, "map", photo)
+	return err
+}
+
+func (notifier *TelegramNotifier) deleteMessage(chatId, messageId string) {
+	_, err := notifier.callApi("deleteMessage", map[string]any{
+		"chat_id":    chatId,
+		"message_id": telegramMessageId(messageId),
+	})
+	if err != nil {
+		log.Printf("Failed to delete Telegram message %s from %s: %v\n", messageId, chatId, err)
+	}
+}
+
+func (notifier *TelegramNotifier) methodUrl(method string) string {
+	return fmt.Sprintf("%s/bot%s/%s", notifier.apiUrl, notifier.token, method)
+}
+
+func (notifier *TelegramNotifier) callApi(method string, payload any) (json.RawMessage, error) {
+	var response telegramResponse
+	_, err := sendJson(http.MethodPost, notifier.methodUrl(method), nil, payload, &response)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method, err)
+	}
+	if !response.Ok {
+		return nil, fmt.Errorf("%s failed: %s", method, response.Description)
+	}
+	return response.Result, nil
+}
+
+func (notifier *TelegramNotifier) callMultipart(method string, fields map[string]string, fileField string, file []byte) (json.RawMessage, error) {
+	payload := new(bytes.Buffer)
+	writer := multipart.NewWriter(payload)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	partWriter, err := writer.CreateFormFile(fileField, "map.png")
+	if err != nil {
+		return nil, err
+	}
+	if _, err = partWriter.Write(file); err != nil {
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, notifier.methodUrl(method), payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	var response telegramResponse
+	if _, err = doRequest(req, &response); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", method, err)
+	}
+	if !response.Ok {
+		return nil, fmt.Errorf("%s failed: %s", method, response.Description)
+	}
+	return response.Result, nil
+}
+
+func parseTelegramMessageId(result json.RawMessage) (string, error) {
+	var message telegramMessage
+	if err := json.Unmarshal(result, &message); err != nil {
+		return "", fmt.Errorf("failed to get message id from result: %w", err)
+	}
+	return strconv.FormatInt(message.MessageId, 10), nil
+}
+
+// telegramMessageId converts a stored message id back to the integer the api
+// expects in json payloads.
+func telegramMessageId(messageId string) any {
+	if id, err := strconv.ParseInt(messageId, 10, 64); err == nil {
+		return id
+	}
+	return messageId
+}
+
+func telegramKey(chatId string) string {
+	return "telegram:" + chatId
+}
+
+// createTelegramListing returns the listing text and the map thumbnail of the
+// first listed star, if any.
+func createTelegramListing(stars *[]*Star) (string, []byte) {
+	stars = sortedStars(stars)
+	now := time.Now().Unix()
+
+	var lines []string
+	for _, star := range *stars {
+		lines = append(lines, formatTelegramStarLine(star, now))
+	}
+	if len(lines) == 0 {
+		return "No stars at the moment :(", nil
+	}
+
+	first := (*stars)[0].MappedLocation
+	thumbnail, err := GetThumbnail(first.X, first.Y, MapWidth, MapHeight)
+	if err != nil {
+		log.Println("Failed to create Telegram listing thumbnail:", err)
+		return truncateLines(lines, telegramTextLimit), nil
+	}
+	return truncateLines(lines, telegramCaptionLimit), thumbnail
+}
+
+func formatTelegramStarLine(star *Star, now int64) string {
+	return fmt.Sprintf(
+		"<b>[World %d, tier %d]</b> %s (est. depletion: %s)%s",
+		star.World,
+		star.Tier,
+		html.EscapeString(star.CalledLocation),
+		formatRelativeTime(star.DepleteTime, now),
+		html.EscapeString(formatHomePointDistance(star)),
+	)
+}
+
+// formatRelativeTime formats a timestamp for platforms without client side
+// time formatting, e.g. "14:05 UTC, in 12 min".
+func formatRelativeTime(timestamp, now int64) string {
+	clock := time.Unix(timestamp, 0).UTC().Format("15:04 UTC")
+	minutes := (timestamp - now) / 60
+	if minutes < 0 {
+		return fmt.Sprintf("%s, %d min ago", clock, -minutes)
+	}
+	return fmt.Sprintf("%s, in %d min", clock, minutes)
+}
+
+// truncateLines joins as many lines as fit within limit characters.
+func truncateLines(lines []string, limit int) string {
+	content := ""
+	for _, line := range lines {
+		if len([]rune(content))+len([]rune(line))+1 > limit {
+			break
+		}
+		if len(content) > 0 {
+			content += "\n"
+		}
+		content += line
+	}
+	return content
+}
@@ -0,0 +1,140 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func telegramMethods(requests []recordedRequest) []string {
+	var methods []string
+	for _, request := range requests {
+		methods = append(methods, strings.TrimPrefix(request.Path, "/bottoken/"))
+	}
+	return methods
+}
+
+func TestTelegramNotifierListing(t *testing.T) {
+	editError := ""
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		if strings.HasSuffix(request.Path, "/editMessageMedia") && len(editError) > 0 {
+			return telegramResponse{Ok: false, Description: editError}
+		}
+		return telegramResponse{Ok: true, Result: json.RawMessage(`{"message_id":42}`)}
+	})
+	database := newTestDatabase(t)
+	notifier := NewTelegramNotifier(server.URL+"/", "token", []string{"-100"}, database)
+	location := &StarLocation{Name: "Aldarin", X: 1000, Y: 2000}
+	stars := testLocationStars(location, 2)
+	// the listing thumbnail uses the default map size
+	thumbnailCacheLock.Lock()
+	thumbnailCache[fmt.Sprintf("%d_%d_%dx%d", location.X, location.Y, MapWidth, MapHeight)] = []byte("png")
+	thumbnailCacheLock.Unlock()
+
+	if err := notifier.PostListing(&stars); err != nil {
+		t.Fatalf("PostListing failed: %v", err)
+	}
+	requests := server.take()
+	if methods := telegramMethods(requests); !slices.Equal(methods, []string{"sendPhoto", "pinChatMessage"}) {
+		t.Fatalf("unexpected requests for posting the listing: %v", methods)
+	}
+	if requests[1].Body["message_id"] != float64(42) || requests[1].Body["disable_notification"] != true {
+		t.Errorf("unexpected pin request: %+v", requests[1].Body)
+	}
+	if messageId := database.GetListingMessage(telegramKey("-100")); messageId == nil || *messageId != "42" {
+		t.Fatalf("listing message was not stored: %v", messageId)
+	}
+
+	if err := notifier.UpdateListing(&stars); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	if methods := telegramMethods(server.take()); !slices.Equal(methods, []string{"editMessageMedia"}) {
+		t.Fatalf("unexpected requests for editing the listing: %v", methods)
+	}
+
+	// an unchanged listing is not an error
+	editError = "Bad Request: message is not modified"
+	if err := notifier.UpdateListing(&stars); err != nil {
+		t.Fatalf("UpdateListing failed for an unchanged listing: %v", err)
+	}
+	server.take()
+
+	editError = "Bad Request: message to edit not found"
+	if err := notifier.UpdateListing(&stars); err != nil {
+		t.Fatalf("UpdateListing failed: %v", err)
+	}
+	if methods := telegramMethods(server.take()); !slices.Equal(methods, []string{"editMessageMedia", "deleteMessage", "sendPhoto", "pinChatMessage"}) {
+		t.Fatalf("deleted listing message was not replaced: %v", methods)
+	}
+
+	editError = "Bad Request: chat not found"
+	if err := notifier.UpdateListing(&stars); err == nil || !strings.Contains(err.Error(), "chat not found") {
+		t.Errorf("expected the edit error to be returned: %v", err)
+	}
+}
+
+func TestTelegramNotifierNewStars(t *testing.T) {
+	server := newRecordingServer(t, func(request recordedRequest) any {
+		return telegramResponse{Ok: true, Result: json.RawMessage(`{"message_id":7}`)}
+	})
+	database := newTestDatabase(t)
+	notifier := NewTelegramNotifier(server.URL, "token", []string{"-100"}, database)
+
+	stars := &[]*Star{{CalledLocation: "Rimmington <mine>", Tier: 8, World: 330, DepleteTime: time.Now().Unix() + 600}}
+	postedAt := time.Now().Unix() - int64(NewStarMessageMaxAge) - 1
+	if err := notifier.AnnounceNewStars(stars, postedAt); err != nil {
+		t.Fatalf("AnnounceNewStars failed: %v", err)
+	}
+	requests := server.take()
+	if methods := telegramMethods(requests); !slices.Equal(methods, []string{"sendMessage"}) {
+		t.Fatalf("unexpected requests for posting new stars: %v", methods)
+	}
+	text := requests[0].Body["text"].(string)
+	if !strings.HasPrefix(text, "⭐ <b>[World 330, tier 8]</b> Rimmington &lt;mine&gt;") || requests[0].Body["parse_mode"] != "HTML" {
+		t.Errorf("unexpected message %+v", requests[0].Body)
+	}
+
+	if err := notifier.RetractMessages(time.Now().Unix()); err != nil {
+		t.Fatalf("RetractMessages failed: %v", err)
+	}
+	requests = server.take()
+	if methods := telegramMethods(requests); !slices.Equal(methods, []string{"deleteMessage"}) || requests[0].Body["message_id"] != float64(7) {
+		t.Fatalf("unexpected requests for retracting new stars: %+v", requests)
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	lines := []string{"ⓐⓑⓒ", "def", "ghi"}
+	for _, test := range []struct {
+		limit    int
+		expected string
+	}{
+		{2, ""},
+		{4, "ⓐⓑⓒ"},
+		{7, "ⓐⓑⓒ\ndef"},
+		{100, "ⓐⓑⓒ\ndef\nghi"},
+	} {
+		if content := truncateLines(lines, test.limit); content != test.expected {
+			t.Errorf("truncateLines with limit %d = %q, expected %q", test.limit, content, test.expected)
+		}
+	}
+}
+
+func TestFormatRelativeTime(t *testing.T) {
+	now := time.Date(2026, time.March, 1, 14, 0, 0, 0, time.UTC).Unix()
+	for _, test := range []struct {
+		offset   int64
+		expected string
+	}{
+		{0, "14:00 UTC, in 0 min"},
+		{12*60 + 30, "14:12 UTC, in 12 min"},
+		{-5 * 60, "13:55 UTC, 5 min ago"},
+	} {
+		if formatted := formatRelativeTime(now+test.offset, now); formatted != test.expected {
+			t.Errorf("formatRelativeTime(%+d) = %q, expected %q", test.offset, formatted, test.expected)
+		}
+	}
+}
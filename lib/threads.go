@@ -0,0 +1,50 @@
+package lib
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IsForum tells whether the webhook posts to a forum channel, creating a
+// post for every new star named after the threadName template.
+func (webhook *Webhook) IsForum() bool {
+	return len(webhook.ThreadName) > 0
+}
+
+// FormatThreadName fills {world}, {tier} and {location} in the threadName
+// template of the webhook.
+func (webhook *Webhook) FormatThreadName(star *Star) string {
+	name := strings.NewReplacer(
+		"{world}", strconv.Itoa(star.World),
+		"{tier}", strconv.Itoa(star.Tier),
+		"{location}", star.CalledLocation,
+	).Replace(webhook.ThreadName)
+	// thread names are limited to 100 characters
+	return truncate(name, 100)
+}
+
+// queueNewStars adds new star messages to the outbox. Forum webhooks get a
+// message, and with it a post, for every star. Retained messages are not
+// deleted after the max age of the webhook.
+func (notifier *DiscordNotifier) queueNewStars(webhook *Webhook, stars *[]*Star, timestamp int64, retained bool) {
+	if !webhook.IsForum() {
+		notifier.queueNewStarMessage(webhook, stars, timestamp, retained)
+		return
+	}
+	for _, star := range *stars {
+		notifier.queueNewStarMessage(webhook, &[]*Star{star}, timestamp, retained)
+	}
+}
+
+// queueNewStarMessage adds a new star message to the outbox. Mentions are
+// recorded as soon as they are queued, so that the following messages of the
+// batch and the messages queued while this one is pending respect the
+// cooldown.
+func (notifier *DiscordNotifier) queueNewStarMessage(webhook *Webhook, stars *[]*Star, timestamp int64, retained bool) {
+	database := notifier.database
+	roleIds := webhook.FilterMentions(webhook.GetMentionedRoles(stars), timestamp, database)
+	webhook.RecordMentions(roleIds, timestamp, database)
+	entry := newNewStarsEntry(webhook, stars, roleIds, timestamp)
+	entry.Retained = retained
+	notifier.enqueue(entry)
+}
@@ -0,0 +1,39 @@
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	mapLib "github.com/cubeee/ent-notifier/lib"
+	"image/png"
+	"sync"
+)
+
+var (
+	thumbnailCache     = make(map[string][]byte)
+	thumbnailCacheLock sync.Mutex
+)
+
+// GetThumbnail returns a png encoded map thumbnail centered on the given
+// coordinates. Thumbnails are cached as the same few locations and sizes are
+// requested for every listing update.
+func GetThumbnail(x, y, width, height int) ([]byte, error) {
+	key := fmt.Sprintf("%d_%d_%dx%d", x, y, width, height)
+
+	thumbnailCacheLock.Lock()
+	defer thumbnailCacheLock.Unlock()
+	if cached, ok := thumbnailCache[key]; ok {
+		return cached, nil
+	}
+
+	mapImage, err := mapLib.CreateThumbnail(x, y, width, height)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail: %w", err)
+	}
+	buffer := new(bytes.Buffer)
+	if err = png.Encode(buffer, mapImage); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	thumbnailCache[key] = buffer.Bytes()
+	return thumbnailCache[key], nil
+}
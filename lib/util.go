@@ -25,6 +25,16 @@ func GetEnvInt(key string, fallback int) int {
 	return intValue
 }
 
+func GetEnvBool(key string, fallback bool) bool {
+	value := GetEnv(key, strconv.FormatBool(fallback))
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Println("Failed to read env var into a bool")
+		panic(err)
+	}
+	return boolValue
+}
+
 func GetEnvList(key string, delimiter string) []string {
 	value := GetEnv(key, "")
 	if len(value) == 0 {
@@ -32,3 +42,13 @@ func GetEnvList(key string, delimiter string) []string {
 	}
 	return strings.Split(value, delimiter)
 }
+
+// truncate shortens value to at most limit characters, replacing the end
+// with "..." when it is cut.
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+	return string(runes[:limit-3]) + "..."
+}
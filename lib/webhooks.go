@@ -0,0 +1,244 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	FormatDefault = "default"
+	FormatCompact = "compact"
+	FormatEmbed   = "embed"
+)
+
+type Webhook struct {
+	Url               string            `json:"url"`
+	Enabled           *bool             `json:"enabled,omitempty"`
+	RoleIds           []string          `json:"roleIds,omitempty"`
+	MentionRules      []MentionRule     `json:"mentionRules,omitempty"`
+	MentionCooldown   int               `json:"mentionCooldown,omitempty"`
+	QuietHours        []QuietHours      `json:"quietHours,omitempty"`
+	TimeZone          string            `json:"timeZone,omitempty"`
+	Filters           StarFilter        `json:"filters"`
+	ListingFooter     *string           `json:"listingFooter,omitempty"`
+	MapWidth          int               `json:"mapWidth,omitempty"`
+	MapHeight         int               `json:"mapHeight,omitempty"`
+	MessageMaxAge     int               `json:"messageMaxAge,omitempty"`
+	Format            string            `json:"format,omitempty"`
+	Delivery          string            `json:"delivery,omitempty"`
+	DigestInterval    int               `json:"digestInterval,omitempty"`
+	DigestMaxStars    int               `json:"digestMaxStars,omitempty"`
+	ThreadId          string            `json:"threadId,omitempty"`
+	ThreadName        string            `json:"threadName,omitempty"`
+	ListingThread     string            `json:"listingThread,omitempty"`
+	ListingIdentity   *WebhookIdentity  `json:"listingIdentity,omitempty"`
+	NewStarIdentities []WebhookIdentity `json:"newStarIdentities,omitempty"`
+
+	timeLocation *time.Location
+}
+
+type StarFilter struct {
+	MinTier        int      `json:"minTier,omitempty"`
+	MaxTier        int      `json:"maxTier,omitempty"`
+	Worlds         []int    `json:"worlds,omitempty"`
+	ExcludedWorlds []int    `json:"excludedWorlds,omitempty"`
+	Locations      []string `json:"locations,omitempty"`
+	WorldTypes     []string `json:"worldTypes,omitempty"`
+}
+
+// MentionRule mentions a role for every star matching the embedded filter.
+type MentionRule struct {
+	RoleId   string `json:"roleId"`
+	Cooldown int    `json:"cooldown,omitempty"`
+	StarFilter
+}
+
+var Webhooks = loadWebhooks()
+
+func loadWebhooks() []*Webhook {
+	var webhooks []*Webhook
+	if len(WebhookConfigFile) > 0 {
+		configured, err := loadWebhookConfig(WebhookConfigFile)
+		if err != nil {
+			log.Println("Failed to load webhook config from", WebhookConfigFile)
+			panic(err)
+		}
+		webhooks = configured
+	} else {
+		webhooks = parseWebhookUrls(WebhookUrls)
+	}
+
+	for _, webhook := range webhooks {
+		webhook.applyDefaults()
+	}
+	return webhooks
+}
+
+func loadWebhookConfig(filePath string) ([]*Webhook, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook config: %w", err)
+	}
+
+	var webhooks []*Webhook
+	if err = json.Unmarshal(content, &webhooks); err != nil {
+		return nil, fmt.Errorf("failed to parse webhook config: %w", err)
+	}
+
+	webhooks = slices.DeleteFunc(webhooks, func(webhook *Webhook) bool {
+		if len(webhook.Url) == 0 {
+			log.Println("Ignoring webhook config entry without an url")
+			return true
+		}
+		return false
+	})
+	return webhooks, nil
+}
+
+// parseWebhookUrls supports the DISCORD_WEBHOOK_URLS syntax of "url" or
+// "url=roleId" entries.
+func parseWebhookUrls(urls []string) []*Webhook {
+	var webhooks []*Webhook
+	for _, url := range urls {
+		if len(url) == 0 {
+			continue
+		}
+		webhook := &Webhook{Url: url}
+		if strings.Contains(url, "=") {
+			parts := strings.Split(url, "=")
+			webhook.Url = parts[0]
+			webhook.RoleIds = []string{parts[1]}
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks
+}
+
+func (webhook *Webhook) applyDefaults() {
+	if webhook.ListingFooter == nil {
+		footer := ListingFooter
+		webhook.ListingFooter = &footer
+	}
+	if webhook.MapWidth <= 0 {
+		webhook.MapWidth = MapWidth
+	}
+	if webhook.MapHeight <= 0 {
+		webhook.MapHeight = MapHeight
+	}
+	if webhook.MessageMaxAge <= 0 {
+		webhook.MessageMaxAge = NewStarMessageMaxAge
+	}
+	if webhook.Format != FormatDefault && webhook.Format != FormatCompact && webhook.Format != FormatEmbed {
+		if len(webhook.Format) > 0 {
+			log.Printf("Unknown format '%s' for webhook, using default\n", webhook.Format)
+		}
+		webhook.Format = FormatDefault
+	}
+	if webhook.Delivery != DeliveryImmediate && webhook.Delivery != DeliveryDigest {
+		if len(webhook.Delivery) > 0 {
+			log.Printf("Unknown delivery mode '%s' for webhook, delivering immediately\n", webhook.Delivery)
+		}
+		webhook.Delivery = DeliveryImmediate
+	}
+	if webhook.DigestInterval <= 0 {
+		webhook.DigestInterval = DigestInterval
+	}
+	if webhook.IsForum() && len(webhook.ThreadId) > 0 {
+		log.Println("Both threadId and threadName set for webhook, creating forum posts")
+		webhook.ThreadId = ""
+	}
+	if len(webhook.ListingThread) == 0 {
+		webhook.ListingThread = "Star listing"
+	}
+	webhook.timeLocation = time.Local
+	if len(webhook.TimeZone) > 0 {
+		location, err := time.LoadLocation(webhook.TimeZone)
+		if err != nil {
+			log.Printf("Unknown time zone '%s' for webhook, using local time\n", webhook.TimeZone)
+		} else {
+			webhook.timeLocation = location
+		}
+	}
+	for _, quietHours := range webhook.QuietHours {
+		if _, err := parseClock(quietHours.Start); err != nil {
+			log.Println("Invalid quiet hours start for webhook:", err)
+		}
+		if _, err := parseClock(quietHours.End); err != nil {
+			log.Println("Invalid quiet hours end for webhook:", err)
+		}
+	}
+}
+
+func (webhook *Webhook) IsEnabled() bool {
+	return webhook.Enabled == nil || *webhook.Enabled
+}
+
+func GetEnabledWebhooks(webhooks []*Webhook) []*Webhook {
+	return slices.DeleteFunc(slices.Clone(webhooks), func(webhook *Webhook) bool {
+		return !webhook.IsEnabled()
+	})
+}
+
+func (filter *StarFilter) Matches(star *Star) bool {
+	if filter.MinTier > 0 && star.Tier < filter.MinTier {
+		return false
+	}
+	if filter.MaxTier > 0 && star.Tier > filter.MaxTier {
+		return false
+	}
+	if len(filter.Worlds) > 0 && !slices.Contains(filter.Worlds, star.World) {
+		return false
+	}
+	if slices.Contains(filter.ExcludedWorlds, star.World) {
+		return false
+	}
+	if len(filter.Locations) > 0 && !slices.ContainsFunc(filter.Locations, func(location string) bool {
+		return matchesLocation(location, star.Location, star.MappedLocation)
+	}) {
+		return false
+	}
+	if len(filter.WorldTypes) > 0 && !slices.ContainsFunc(filter.WorldTypes, func(worldType string) bool {
+		return strings.EqualFold(worldType, GetWorldType(star.World))
+	}) {
+		return false
+	}
+	return true
+}
+
+func (filter *StarFilter) Apply(stars *[]*Star) *[]*Star {
+	var filtered []*Star
+	for _, star := range *stars {
+		if filter.Matches(star) {
+			filtered = append(filtered, star)
+		}
+	}
+	return &filtered
+}
+
+// GetMentionedRoles returns the deduplicated roles to mention for a batch of
+// stars, starting with the roles mentioned for every star.
+func (webhook *Webhook) GetMentionedRoles(stars *[]*Star) []string {
+	var roleIds []string
+	mention := func(roleId string) {
+		if len(roleId) > 0 && !slices.Contains(roleIds, roleId) {
+			roleIds = append(roleIds, roleId)
+		}
+	}
+
+	for _, roleId := range webhook.RoleIds {
+		mention(roleId)
+	}
+	for _, star := range *stars {
+		for _, rule := range webhook.MentionRules {
+			if rule.Matches(star) {
+				mention(rule.RoleId)
+			}
+		}
+	}
+	return roleIds
+}
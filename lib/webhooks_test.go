@@ -0,0 +1,71 @@
+package lib
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestStarFilterMatches(t *testing.T) {
+	location := &StarLocation{Name: "Aldarin", Region: "Varlamore"}
+	star := &Star{Location: 7, MappedLocation: location, Tier: 6, World: 330}
+
+	for _, test := range []struct {
+		name    string
+		filter  StarFilter
+		matches bool
+	}{
+		{"empty filter", StarFilter{}, true},
+		{"min tier", StarFilter{MinTier: 6}, true},
+		{"below min tier", StarFilter{MinTier: 7}, false},
+		{"max tier", StarFilter{MaxTier: 6}, true},
+		{"above max tier", StarFilter{MaxTier: 5}, false},
+		{"worlds", StarFilter{Worlds: []int{301, 330}}, true},
+		{"other worlds", StarFilter{Worlds: []int{301}}, false},
+		{"excluded world", StarFilter{ExcludedWorlds: []int{330}}, false},
+		{"location id", StarFilter{Locations: []string{"7"}}, true},
+		{"other location id", StarFilter{Locations: []string{"8"}}, false},
+		{"location name", StarFilter{Locations: []string{"aldarin"}}, true},
+		{"location region", StarFilter{Locations: []string{"Desert", " varlamore "}}, true},
+		{"other location", StarFilter{Locations: []string{"Desert"}}, false},
+		{"world type", StarFilter{WorldTypes: []string{"Members"}}, GetWorldType(330) == WorldTypeMembers},
+		{"all conditions", StarFilter{MinTier: 5, MaxTier: 9, Worlds: []int{330}, Locations: []string{"Aldarin"}}, true},
+		{"one failing condition", StarFilter{MinTier: 5, MaxTier: 9, Worlds: []int{330}, Locations: []string{"Desert"}}, false},
+	} {
+		if matches := test.filter.Matches(star); matches != test.matches {
+			t.Errorf("%s: filter %+v matches %v, expected %v", test.name, test.filter, matches, test.matches)
+		}
+	}
+}
+
+func TestGetMentionedRoles(t *testing.T) {
+	webhook := &Webhook{
+		RoleIds: []string{"everyone"},
+		MentionRules: []MentionRule{
+			{RoleId: "high", StarFilter: StarFilter{MinTier: 8}},
+			{RoleId: "aldarin", StarFilter: StarFilter{Locations: []string{"Aldarin"}}},
+			{RoleId: "everyone", StarFilter: StarFilter{MinTier: 1}},
+		},
+	}
+	aldarin := &StarLocation{Name: "Aldarin"}
+	desert := &StarLocation{Name: "Desert"}
+
+	for _, test := range []struct {
+		name    string
+		stars   []*Star
+		roleIds []string
+	}{
+		{"no stars", nil, []string{"everyone"}},
+		{"no matching rule", []*Star{{MappedLocation: desert, Tier: 0}}, []string{"everyone"}},
+		{"one rule", []*Star{{MappedLocation: desert, Tier: 9}}, []string{"everyone", "high"}},
+		{"rules in order", []*Star{{MappedLocation: aldarin, Tier: 9}}, []string{"everyone", "high", "aldarin"}},
+		{
+			"roles of all stars",
+			[]*Star{{MappedLocation: aldarin, Tier: 2}, {MappedLocation: desert, Tier: 8}, {MappedLocation: aldarin, Tier: 9}},
+			[]string{"everyone", "aldarin", "high"},
+		},
+	} {
+		if roleIds := webhook.GetMentionedRoles(&test.stars); !slices.Equal(roleIds, test.roleIds) {
+			t.Errorf("%s: mentioned %v, expected %v", test.name, roleIds, test.roleIds)
+		}
+	}
+}
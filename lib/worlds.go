@@ -0,0 +1,37 @@
+package lib
+
+import (
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	WorldTypeFree    = "f2p"
+	WorldTypeMembers = "members"
+)
+
+const defaultFreeWorlds = "301,308,316,326,335,371,379,380,382,383,384,393,394,397,398,399,417,418,430,431,433,434," +
+	"435,436,437,451,452,453,454,455,456,469,470,471,472,473,475,476,483,497,498,499,500,501,537,542,543,544,545," +
+	"546,547,552,553,554,555,571"
+
+func parseWorlds(entries []string) []int {
+	var worlds []int
+	for _, entry := range entries {
+		world, err := strconv.Atoi(strings.TrimSpace(entry))
+		if err != nil {
+			log.Println("Ignoring invalid world", entry)
+			continue
+		}
+		worlds = append(worlds, world)
+	}
+	return worlds
+}
+
+func GetWorldType(world int) string {
+	if slices.Contains(FreeWorlds, world) {
+		return WorldTypeFree
+	}
+	return WorldTypeMembers
+}
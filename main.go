@@ -3,10 +3,10 @@ package main
 import (
 	"fmt"
 	"log"
-	"slices"
 	"star-notifier/lib"
 	"star-notifier/lib/db"
 	"time"
+	_ "time/tzdata"
 )
 
 func main() {
@@ -16,6 +16,11 @@ func main() {
 	}
 	defer saveDb(database)
 
+	notifiers := lib.CreateNotifiers(database)
+	if len(notifiers) == 0 {
+		log.Println("No notifiers configured")
+	}
+
 	lastListingUpdate := int64(0)
 	lastStarCheck := int64(0)
 
@@ -29,7 +34,8 @@ func main() {
 		now := time.Now().Unix()
 		log.Println("Running cycle...", now)
 
-		deleteOldStarMessages(database)
+		retractMessages(notifiers, now)
+		tickNotifiers(notifiers, now)
 
 		if (now - lastStarCheck) >= int64(lib.SleepTime) {
 			log.Println("Checking stars...")
@@ -46,44 +52,25 @@ func main() {
 				if forceUpdateListing {
 					log.Println("Force updating listing...")
 				}
-				err = updateListing(stars, database)
-				if err != nil {
-					log.Println("Failed to update listing", err)
-					waitLoop()
-					lastStarCheck = now
-					listingUpdated = true
-					continue
-				} else {
-					lastListingUpdate = now
-				}
+				updateListing(stars, notifiers)
+				listingUpdated = true
+				lastListingUpdate = now
 			}
 
-			var newStars []*lib.Star
-
-			for _, star := range *stars {
-				if previousStars != nil && !slices.ContainsFunc(*previousStars, func(prev *lib.Star) bool {
-					return star.CalledLocation == prev.CalledLocation && star.Location == prev.Location && star.World == prev.World
-				}) {
-					log.Println("- NEW STAR", *star)
-					newStars = append(newStars, star)
-				}
+			changes := lib.DiffStars(previousStars, stars)
+			newStars := changes.New
+			for _, star := range newStars {
+				log.Println("- NEW STAR", *star)
 			}
+			notifyChanges(changes, notifiers, now)
 
 			if len(newStars) > 0 {
 				if !listingUpdated {
-					if err = updateListing(stars, database); err != nil {
-						log.Println("Failed to update listing after new star", err)
-					}
+					updateListing(stars, notifiers)
 					lastListingUpdate = now
 				}
 
-				err := lib.PostNewStars(&newStars, lib.WebhookUrls, now, database)
-				if err != nil {
-					log.Println("Failed to post new stars", err)
-					waitLoop()
-					lastStarCheck = now
-					continue
-				}
+				announceNewStars(&newStars, notifiers, now)
 			}
 			previousStars = stars
 			lastStarCheck = now
@@ -93,27 +80,53 @@ func main() {
 	}
 }
 
-func deleteOldStarMessages(database *db.Database) {
-	oldMessages := database.GetOldNewStarMessages(lib.NewStarMessageMaxAge)
-	if len(*oldMessages) == 0 {
-		return
+func retractMessages(notifiers []lib.Notifier, timestamp int64) {
+	for _, notifier := range notifiers {
+		if err := notifier.RetractMessages(timestamp); err != nil {
+			log.Printf("Failed to retract %s messages: %v\n", notifier.Name(), err)
+		}
+	}
+}
+
+func tickNotifiers(notifiers []lib.Notifier, timestamp int64) {
+	for _, notifier := range notifiers {
+		if scheduled, ok := notifier.(lib.ScheduledNotifier); ok {
+			if err := scheduled.Tick(timestamp); err != nil {
+				log.Printf("Failed to run scheduled %s work: %v\n", notifier.Name(), err)
+			}
+		}
+	}
+}
+
+func updateListing(stars *[]*lib.Star, notifiers []lib.Notifier) {
+	for _, notifier := range notifiers {
+		if err := notifier.UpdateListing(stars); err != nil {
+			log.Printf("Failed to update %s listing: %v\n", notifier.Name(), err)
+		}
 	}
+}
 
-	log.Printf("Removing %d old message(s)\n", len(*oldMessages))
-	for _, message := range *oldMessages {
-		err := lib.DeleteMessage(message.WebhookUrl, message.MessageId)
-		if err != nil {
-			log.Printf("failed to delete message %s from %s: %f\n", message.MessageId, message.WebhookUrl, err)
+// announceNewStars posts the new stars to every notifier. A failing notifier
+// does not hold back the others, each notifier retries on its own.
+func announceNewStars(stars *[]*lib.Star, notifiers []lib.Notifier, timestamp int64) {
+	for _, notifier := range notifiers {
+		if err := notifier.AnnounceNewStars(stars, timestamp); err != nil {
+			log.Printf("Failed to post new stars to %s: %v\n", notifier.Name(), err)
 		}
-		time.Sleep(1 * time.Second)
 	}
-	database.RemoveNewStarMessages(oldMessages)
-	database.SaveUnsafe()
 }
 
-func updateListing(stars *[]*lib.Star, database *db.Database) error {
-	err := lib.PostStarListing(stars, lib.WebhookUrls, database)
-	return err
+func notifyChanges(changes *lib.StarChanges, notifiers []lib.Notifier, timestamp int64) {
+	if changes.IsEmpty() {
+		return
+	}
+	for _, notifier := range notifiers {
+		if changeNotifier, ok := notifier.(lib.ChangeNotifier); ok {
+			if err := changeNotifier.NotifyChanges(changes, timestamp); err != nil {
+				log.Printf("Failed to notify %s of star changes: %v\n", notifier.Name(), err)
+			}
+		}
+	}
 }
 
 func waitLoop() {